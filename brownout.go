@@ -0,0 +1,75 @@
+package floodgate
+
+import "context"
+
+type decisionKey struct{}
+
+// Admission is the read-only view of a Decision that handlers get from
+// FromContext. It leaves out Done and Cancel, which belong to whoever
+// admitted the request, so a handler cannot complete the request twice.
+type Admission struct {
+	// Level is the backpressure level of the key when the request was admitted.
+	Level Level
+
+	// Reason explains Level.
+	Reason Reason
+
+	// Stats are the key's stats when the request was admitted.
+	Stats Stats
+
+	// Degrade reports that the request was admitted in brownout mode. See
+	// Decision.Degrade.
+	Degrade bool
+
+	// Brownout is a dial from 0 to 1 that rises with overload. See
+	// Decision.Brownout.
+	Brownout float64
+
+	// Probe reports that the request was let through to observe recovery.
+	Probe bool
+
+	// Shadowed reports that the request was let through in shadow mode.
+	Shadowed bool
+
+	// Criticality is the request tier, from WithCriticality.
+	Criticality Criticality
+
+	// Tenant is the tenant the request belongs to, from WithTenant.
+	Tenant string
+}
+
+// NewContext returns a copy of ctx carrying the Admission of decision, for
+// FromContext. The gRPC interceptor, HTTP middleware and Do attach the
+// decision of every admitted request.
+func NewContext(ctx context.Context, decision Decision) context.Context {
+	return context.WithValue(ctx, decisionKey{}, Admission{
+		Level:       decision.Level,
+		Reason:      decision.Reason,
+		Stats:       decision.Stats,
+		Degrade:     decision.Degrade,
+		Brownout:    decision.Brownout,
+		Probe:       decision.Probe,
+		Shadowed:    decision.Shadowed,
+		Criticality: decision.Criticality,
+		Tenant:      decision.Tenant,
+	})
+}
+
+// FromContext returns the admission of the current request, so handlers can
+// see the backpressure they are running under.
+//
+// Example:
+//
+//	if admission, ok := floodgate.FromContext(ctx); ok && admission.Degrade {
+//	    return cachedRecommendations(ctx)
+//	}
+func FromContext(ctx context.Context) (Admission, bool) {
+	admission, ok := ctx.Value(decisionKey{}).(Admission)
+	return admission, ok
+}
+
+// brownoutDial returns how far stats are past thresholds as a value from 0
+// to 1, using the same curve as ProportionalShedding.
+func brownoutDial(stats Stats, thresholds Thresholds) float64 {
+	return ProportionalShedding{MaxRatio: 1}.RejectRatio(stats, thresholds)
+}
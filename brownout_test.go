@@ -0,0 +1,55 @@
+package floodgate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBrownoutDial(t *testing.T) {
+	thresholds := DefaultThresholds()
+
+	tests := []struct {
+		name  string
+		stats Stats
+		want  float64
+	}{
+		{"within thresholds", Stats{EMA: 100 * time.Millisecond, P95: 500 * time.Millisecond}, 0},
+		{"twice p95 moderate", Stats{P95: 2 * thresholds.P95Moderate}, 0.5},
+		{"four times ema critical", Stats{EMA: 4 * thresholds.EMACritical}, 0.75},
+	}
+
+	for _, tt := range tests {
+		if got := brownoutDial(tt.stats, thresholds); got != tt.want {
+			t.Errorf("%s: brownoutDial = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewContext_CarriesAdmissionOnly(t *testing.T) {
+	ctx := WithTenant(context.Background(), "acme")
+	cfg := testGateConfig()
+	cfg.ConcurrencyLimiter = func() *Limiter {
+		return NewLimiter(AIMDLimit{}, 1, 1, 1)
+	}
+	gate := NewGate(ctx, cfg)
+
+	decision, err := gate.Admit(ctx, "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admission, ok := FromContext(NewContext(ctx, decision))
+	if !ok || admission.Level != decision.Level || admission.Tenant != "acme" {
+		t.Fatalf("Unexpected admission: %+v", admission)
+	}
+	decision.Done(time.Millisecond, nil)
+
+	// Only the admitting caller can complete the request, so the limiter
+	// and tenant counts are released exactly once
+	if inFlight := gate.state("jobs").limiter.InFlight(); inFlight != 0 {
+		t.Errorf("Expected no requests in flight, got %d", inFlight)
+	}
+	if inFlight := gate.state("jobs").tenantInFlight.Load(); inFlight != 0 {
+		t.Errorf("Expected no tenant requests in flight, got %d", inFlight)
+	}
+}
@@ -0,0 +1,113 @@
+package floodgate
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cgroupReader reads cgroup v2 CPU and memory usage. Missing files, e.g.
+// outside a container or on cgroup v1, make its signals read as zero.
+type cgroupReader struct {
+	path string
+
+	// Previous CPU usage sample, for the usage rate
+	lastUsage time.Duration
+	lastTime  time.Time
+}
+
+// cpuRatio returns CPU usage since the previous call as a fraction of the
+// cgroup's CPU quota. It returns zero on the first call and when there is no
+// quota.
+func (c *cgroupReader) cpuRatio(now time.Time) float64 {
+	quota, ok := c.cpuQuota()
+	if !ok {
+		return 0
+	}
+	usage, ok := c.cpuUsage()
+	if !ok {
+		return 0
+	}
+
+	lastUsage, lastTime := c.lastUsage, c.lastTime
+	c.lastUsage, c.lastTime = usage, now
+	if lastTime.IsZero() || !now.After(lastTime) {
+		return 0
+	}
+
+	return float64(usage-lastUsage) / (float64(now.Sub(lastTime)) * quota)
+}
+
+// cpuQuota returns the CPU quota in cores from cpu.max.
+func (c *cgroupReader) cpuQuota() (float64, bool) {
+	fields := strings.Fields(c.read("cpu.max"))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, false
+	}
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0, false
+	}
+	return quota / period, true
+}
+
+// cpuUsage returns the total CPU time used from cpu.stat.
+func (c *cgroupReader) cpuUsage() (time.Duration, bool) {
+	usec, ok := c.stat("cpu.stat", "usage_usec")
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// memoryRatio returns the working set, memory.current less the reclaimable
+// inactive_file page cache from memory.stat, as a fraction of memory.max, or
+// zero when there is no limit.
+func (c *cgroupReader) memoryRatio() float64 {
+	limit, err := strconv.ParseUint(c.read("memory.max"), 10, 64)
+	if err != nil || limit == 0 {
+		return 0
+	}
+	current, err := strconv.ParseUint(c.read("memory.current"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	if inactive, ok := c.stat("memory.stat", "inactive_file"); ok {
+		current -= min(inactive, current)
+	}
+	return float64(current) / float64(limit)
+}
+
+// stat returns the value of key in a flat keyed cgroup file such as cpu.stat.
+func (c *cgroupReader) stat(name, key string) (uint64, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(c.read(name)))
+	for scanner.Scan() {
+		field, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || field != key {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// read returns the trimmed contents of a cgroup file, or "" if it cannot be read.
+func (c *cgroupReader) read(name string) string {
+	data, err := os.ReadFile(filepath.Join(c.path, name))
+	if err != nil {
+		return ""
+	}
+	return string(bytes.TrimSpace(data))
+}
@@ -39,6 +39,8 @@ type CircuitBreaker struct {
 	timeout           time.Duration
 	successThreshold  int
 	minTimeBetweenOps time.Duration
+
+	onStateChange func(from, to CircuitState)
 }
 
 func NewCircuitBreaker(maxFailures int, timeout time.Duration, successThreshold int) *CircuitBreaker {
@@ -52,79 +54,91 @@ func NewCircuitBreaker(maxFailures int, timeout time.Duration, successThreshold
 	}
 }
 
-func (cb *CircuitBreaker) Allow() bool {
+// OnStateChange registers fn to be called once per state transition. fn runs
+// after the breaker's lock is released, on the goroutine that caused the
+// transition, so it should return quickly. A nil fn removes the callback.
+func (cb *CircuitBreaker) OnStateChange(fn func(from, to CircuitState)) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
+	cb.onStateChange = fn
+}
 
-	now := time.Now()
-
-	switch cb.state {
-	case StateClosed:
-		return true
-
-	case StateOpen:
-		if now.Sub(cb.lastStateTime) >= cb.timeout {
-			cb.state = StateHalfOpen
-			cb.successCount = 0
-			cb.failureCount = 0
-			cb.lastStateTime = now
-			return true
-		}
-		return false
-
-	case StateHalfOpen:
-		return true
+// update runs fn under the lock and reports a resulting state change to the
+// callback once the lock is released.
+func (cb *CircuitBreaker) update(fn func(now time.Time)) {
+	cb.mu.Lock()
+	from := cb.state
+	fn(time.Now())
+	to, onStateChange := cb.state, cb.onStateChange
+	cb.mu.Unlock()
 
-	default:
-		return false
+	if onStateChange != nil && from != to {
+		onStateChange(from, to)
 	}
 }
 
-func (cb *CircuitBreaker) RecordSuccess() {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	now := time.Now()
+func (cb *CircuitBreaker) Allow() bool {
+	var allowed bool
+	cb.update(func(now time.Time) {
+		switch cb.state {
+		case StateClosed:
+			allowed = true
 
-	switch cb.state {
-	case StateHalfOpen:
-		cb.successCount++
-		if cb.successCount >= cb.successThreshold {
-			if now.Sub(cb.lastStateTime) >= cb.minTimeBetweenOps {
-				cb.state = StateClosed
-				cb.failureCount = 0
+		case StateOpen:
+			if now.Sub(cb.lastStateTime) >= cb.timeout {
+				cb.state = StateHalfOpen
 				cb.successCount = 0
+				cb.failureCount = 0
 				cb.lastStateTime = now
+				allowed = true
 			}
+
+		case StateHalfOpen:
+			allowed = true
 		}
+	})
+	return allowed
+}
 
-	case StateClosed:
-		cb.failureCount = 0
-	}
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.update(func(now time.Time) {
+		switch cb.state {
+		case StateHalfOpen:
+			cb.successCount++
+			if cb.successCount >= cb.successThreshold {
+				if now.Sub(cb.lastStateTime) >= cb.minTimeBetweenOps {
+					cb.state = StateClosed
+					cb.failureCount = 0
+					cb.successCount = 0
+					cb.lastStateTime = now
+				}
+			}
+
+		case StateClosed:
+			cb.failureCount = 0
+		}
+	})
 }
 
 func (cb *CircuitBreaker) RecordFailure() {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	now := time.Now()
+	cb.update(func(now time.Time) {
+		switch cb.state {
+		case StateClosed:
+			cb.failureCount++
+			if cb.failureCount >= cb.maxFailures {
+				if now.Sub(cb.lastStateTime) >= cb.minTimeBetweenOps {
+					cb.state = StateOpen
+					cb.lastStateTime = now
+				}
+			}
 
-	switch cb.state {
-	case StateClosed:
-		cb.failureCount++
-		if cb.failureCount >= cb.maxFailures {
+		case StateHalfOpen:
 			if now.Sub(cb.lastStateTime) >= cb.minTimeBetweenOps {
 				cb.state = StateOpen
 				cb.lastStateTime = now
 			}
 		}
-
-	case StateHalfOpen:
-		if now.Sub(cb.lastStateTime) >= cb.minTimeBetweenOps {
-			cb.state = StateOpen
-			cb.lastStateTime = now
-		}
-	}
+	})
 }
 
 func (cb *CircuitBreaker) State() CircuitState {
@@ -133,12 +147,184 @@ func (cb *CircuitBreaker) State() CircuitState {
 	return cb.state
 }
 
+// rejecting reports whether cb is open and its timeout has not yet elapsed,
+// so that Allow would reject without probing.
+func (cb *CircuitBreaker) rejecting(now time.Time) bool {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+	return cb.state == StateOpen && now.Sub(cb.lastStateTime) < cb.timeout
+}
+
 func (cb *CircuitBreaker) Reset() {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
+	cb.update(func(now time.Time) {
+		cb.state = StateClosed
+		cb.failureCount = 0
+		cb.successCount = 0
+		cb.lastStateTime = now
+	})
+}
+
+// CircuitMode selects how circuit breakers are scoped across methods/routes.
+type CircuitMode int
+
+const (
+	// CircuitPerKey gives every method/route its own breaker, so one slow
+	// endpoint cannot trip the breaker for healthy ones.
+	CircuitPerKey CircuitMode = iota
+
+	// CircuitGlobal shares a single breaker across all methods/routes.
+	CircuitGlobal
+
+	// CircuitHybrid gives every method/route its own breaker and additionally
+	// rejects all traffic while a threshold number of breakers are open.
+	CircuitHybrid
+)
+
+func (m CircuitMode) String() string {
+	switch m {
+	case CircuitPerKey:
+		return "per-key"
+	case CircuitGlobal:
+		return "global"
+	case CircuitHybrid:
+		return "hybrid"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitGroup hands out circuit breakers for keys according to a CircuitMode.
+type CircuitGroup struct {
+	mode            CircuitMode
+	hybridThreshold int
+
+	maxFailures      int
+	timeout          time.Duration
+	successThreshold int
+
+	global *CircuitBreaker
+
+	onStateChange func(key string, from, to CircuitState)
+
+	// open holds the breakers of the keys last observed open (hybrid mode only).
+	mu   sync.Mutex
+	open map[string]*CircuitBreaker
+}
+
+// NewCircuitGroup creates a group of circuit breakers. hybridThreshold is the
+// number of open per-key breakers that trips every key in CircuitHybrid mode;
+// values less than 1 are clamped to 1.
+func NewCircuitGroup(mode CircuitMode, hybridThreshold, maxFailures int, timeout time.Duration, successThreshold int) *CircuitGroup {
+	if hybridThreshold < 1 {
+		hybridThreshold = 1
+	}
+
+	g := &CircuitGroup{
+		mode:             mode,
+		hybridThreshold:  hybridThreshold,
+		maxFailures:      maxFailures,
+		timeout:          timeout,
+		successThreshold: successThreshold,
+		open:             make(map[string]*CircuitBreaker),
+	}
+	if mode == CircuitGlobal {
+		g.global = NewCircuitBreaker(maxFailures, timeout, successThreshold)
+	}
+	return g
+}
+
+// Mode returns the group's circuit mode.
+func (g *CircuitGroup) Mode() CircuitMode {
+	return g.mode
+}
+
+// OnStateChange registers fn to be called once per state transition of any
+// breaker in the group. In CircuitGlobal mode key is empty. Call it before
+// handing out breakers; breakers created earlier keep their callbacks.
+func (g *CircuitGroup) OnStateChange(fn func(key string, from, to CircuitState)) {
+	g.onStateChange = fn
+	if g.global != nil {
+		g.global.OnStateChange(g.notify(""))
+	}
+}
+
+// notify binds the group's callback to key, or returns nil without one.
+func (g *CircuitGroup) notify(key string) func(from, to CircuitState) {
+	fn := g.onStateChange
+	if fn == nil {
+		return nil
+	}
+	return func(from, to CircuitState) { fn(key, from, to) }
+}
+
+// Breaker returns the breaker to use for a newly tracked key.
+// In CircuitGlobal mode every key shares the same breaker.
+func (g *CircuitGroup) Breaker(key string) *CircuitBreaker {
+	if g.mode == CircuitGlobal {
+		return g.global
+	}
+	cb := NewCircuitBreaker(g.maxFailures, g.timeout, g.successThreshold)
+	cb.onStateChange = g.notify(key)
+	return cb
+}
+
+// Allow reports whether a request for key may proceed through cb.
+// In CircuitHybrid mode this also rejects every key while the number of open
+// breakers is at or above the hybrid threshold. A breaker stops counting once
+// its timeout elapses, so the group recovers even if the keys that tripped it
+// receive no further traffic.
+func (g *CircuitGroup) Allow(key string, cb *CircuitBreaker) bool {
+	allowed := cb.Allow()
+	if g.mode != CircuitHybrid {
+		return allowed
+	}
+
+	g.Observe(key, cb)
+	if !allowed {
+		return false
+	}
+
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.open) < g.hybridThreshold {
+		return true
+	}
+	for k, open := range g.open {
+		if !open.rejecting(now) {
+			delete(g.open, k)
+		}
+	}
+	return len(g.open) < g.hybridThreshold
+}
+
+// Observe records the current state of cb for key. Call it after
+// RecordSuccess or RecordFailure so hybrid mode sees state changes.
+func (g *CircuitGroup) Observe(key string, cb *CircuitBreaker) {
+	if g.mode != CircuitHybrid {
+		return
+	}
+
+	isOpen := cb.State() == StateOpen
+
+	g.mu.Lock()
+	if isOpen {
+		g.open[key] = cb
+	} else {
+		delete(g.open, key)
+	}
+	g.mu.Unlock()
+}
+
+// Forget drops any state held for key, e.g. when its tracker is evicted.
+func (g *CircuitGroup) Forget(key string) {
+	if g.mode != CircuitHybrid {
+		return
+	}
 
-	cb.state = StateClosed
-	cb.failureCount = 0
-	cb.successCount = 0
-	cb.lastStateTime = time.Now()
+	g.mu.Lock()
+	delete(g.open, key)
+	g.mu.Unlock()
 }
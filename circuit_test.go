@@ -0,0 +1,152 @@
+package floodgate
+
+import (
+	"testing"
+	"time"
+)
+
+func tripBreaker(cb *CircuitBreaker) {
+	// Breakers refuse to change state within minTimeBetweenOps of the last change
+	cb.lastStateTime = time.Now().Add(-time.Hour)
+	for i := 0; i < cb.maxFailures; i++ {
+		cb.RecordFailure()
+	}
+}
+
+func TestCircuitGroup_PerKey(t *testing.T) {
+	g := NewCircuitGroup(CircuitPerKey, 1, 3, time.Minute, 1)
+
+	slow := g.Breaker("slow")
+	fast := g.Breaker("fast")
+	if slow == fast {
+		t.Fatal("Expected distinct breakers per key")
+	}
+
+	tripBreaker(slow)
+	g.Observe("slow", slow)
+
+	if g.Allow("slow", slow) {
+		t.Error("Expected open breaker to reject")
+	}
+	if !g.Allow("fast", fast) {
+		t.Error("Expected healthy key to be allowed")
+	}
+}
+
+func TestCircuitGroup_Global(t *testing.T) {
+	g := NewCircuitGroup(CircuitGlobal, 1, 3, time.Minute, 1)
+
+	a := g.Breaker("a")
+	b := g.Breaker("b")
+	if a != b {
+		t.Fatal("Expected a shared breaker in global mode")
+	}
+
+	tripBreaker(a)
+	if g.Allow("b", b) {
+		t.Error("Expected every key to be rejected once the global breaker opens")
+	}
+}
+
+func TestCircuitGroup_Hybrid(t *testing.T) {
+	g := NewCircuitGroup(CircuitHybrid, 2, 3, time.Minute, 1)
+
+	a, b, c := g.Breaker("a"), g.Breaker("b"), g.Breaker("c")
+
+	tripBreaker(a)
+	g.Observe("a", a)
+	if !g.Allow("c", c) {
+		t.Fatal("Expected healthy key to be allowed below the hybrid threshold")
+	}
+
+	tripBreaker(b)
+	g.Observe("b", b)
+	if g.Allow("c", c) {
+		t.Fatal("Expected all keys to be rejected at the hybrid threshold")
+	}
+
+	g.Forget("b")
+	if !g.Allow("c", c) {
+		t.Fatal("Expected healthy key to be allowed after forgetting an open key")
+	}
+}
+
+func TestCircuitGroup_HybridRecovers(t *testing.T) {
+	g := NewCircuitGroup(CircuitHybrid, 2, 3, time.Minute, 1)
+
+	a, b, c := g.Breaker("a"), g.Breaker("b"), g.Breaker("c")
+
+	tripBreaker(a)
+	g.Observe("a", a)
+	tripBreaker(b)
+	g.Observe("b", b)
+	if g.Allow("c", c) {
+		t.Fatal("Expected all keys to be rejected at the hybrid threshold")
+	}
+
+	// a and b receive no traffic of their own once the group trips, so
+	// their timeouts expiring must be enough to recover
+	a.lastStateTime = time.Now().Add(-time.Hour)
+	b.lastStateTime = time.Now().Add(-time.Hour)
+	if !g.Allow("c", c) {
+		t.Fatal("Expected healthy key to be allowed once open breakers time out")
+	}
+
+	// Keys that fail their probes trip the group again
+	for key, cb := range map[string]*CircuitBreaker{"a": a, "b": b} {
+		if !g.Allow(key, cb) {
+			t.Fatalf("Expected a probe for timed-out key %s", key)
+		}
+		cb.lastStateTime = time.Now().Add(-time.Hour)
+		cb.RecordFailure()
+		g.Observe(key, cb)
+	}
+	if g.Allow("c", c) {
+		t.Error("Expected all keys to be rejected after the breakers reopen")
+	}
+}
+
+func TestCircuitBreaker_OnStateChange(t *testing.T) {
+	type transition struct{ from, to CircuitState }
+	var got []transition
+
+	cb := NewCircuitBreaker(3, 0, 1)
+	cb.OnStateChange(func(from, to CircuitState) {
+		got = append(got, transition{from, to})
+	})
+
+	tripBreaker(cb)
+	cb.RecordFailure() // already open: no transition
+
+	cb.Allow() // timeout of zero moves straight to half-open
+	cb.lastStateTime = time.Now().Add(-time.Hour)
+	cb.RecordSuccess()
+
+	want := []transition{
+		{StateClosed, StateOpen},
+		{StateOpen, StateHalfOpen},
+		{StateHalfOpen, StateClosed},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d transitions, got %v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Transition %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestCircuitGroup_OnStateChange(t *testing.T) {
+	var keys []string
+	g := NewCircuitGroup(CircuitPerKey, 1, 3, time.Minute, 1)
+	g.OnStateChange(func(key string, from, to CircuitState) {
+		keys = append(keys, key)
+	})
+
+	tripBreaker(g.Breaker("slow"))
+
+	if len(keys) != 1 || keys[0] != "slow" {
+		t.Errorf("Expected one transition for key slow, got %v", keys)
+	}
+}
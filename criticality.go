@@ -0,0 +1,86 @@
+package floodgate
+
+import "context"
+
+// Criticality is the importance of a request. Lower tiers are shed at lower
+// backpressure levels so more important traffic keeps flowing.
+type Criticality int
+
+const (
+	// CriticalityDefault is used for requests without a tier. It is rejected
+	// at Critical, as before tiers existed.
+	CriticalityDefault Criticality = iota
+
+	// CriticalityCritical is rejected only at Emergency.
+	CriticalityCritical
+
+	// CriticalitySheddable is rejected from Moderate.
+	CriticalitySheddable
+
+	// CriticalityBackground is rejected from Warning.
+	CriticalityBackground
+)
+
+func (c Criticality) String() string {
+	switch c {
+	case CriticalityDefault:
+		return "default"
+	case CriticalityCritical:
+		return "critical"
+	case CriticalitySheddable:
+		return "sheddable"
+	case CriticalityBackground:
+		return "background"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseCriticality parses a tier name as returned by Criticality.String.
+func ParseCriticality(s string) (Criticality, bool) {
+	switch s {
+	case "default":
+		return CriticalityDefault, true
+	case "critical":
+		return CriticalityCritical, true
+	case "sheddable":
+		return CriticalitySheddable, true
+	case "background":
+		return CriticalityBackground, true
+	default:
+		return CriticalityDefault, false
+	}
+}
+
+// ShedLevel returns the lowest level at which requests of the tier are rejected.
+func (c Criticality) ShedLevel() Level {
+	switch c {
+	case CriticalityCritical:
+		return Emergency
+	case CriticalitySheddable:
+		return Moderate
+	case CriticalityBackground:
+		return Warning
+	default:
+		return Critical
+	}
+}
+
+type criticalityKey struct{}
+
+// WithCriticality returns a copy of ctx carrying the request tier c.
+//
+// Example:
+//
+//	ctx = floodgate.WithCriticality(ctx, floodgate.CriticalityBackground)
+//	err := floodgate.Do(ctx, gate, "reindex", reindex)
+func WithCriticality(ctx context.Context, c Criticality) context.Context {
+	return context.WithValue(ctx, criticalityKey{}, c)
+}
+
+// CriticalityFromContext returns the request tier carried by ctx, or
+// CriticalityDefault if it has none.
+func CriticalityFromContext(ctx context.Context) Criticality {
+	c, _ := ctx.Value(criticalityKey{}).(Criticality)
+	return c
+}
@@ -0,0 +1,149 @@
+package floodgate
+
+import (
+	"math"
+	"time"
+)
+
+// ddSketchMaxBins bounds the memory of a DDSketch. At 1% accuracy it covers
+// about nine orders of magnitude, e.g. 1µs to 15 minutes, before collapsing.
+const ddSketchMaxBins = 1024
+
+// DDSketch is a QuantileEstimator with a relative-error guarantee, from
+// "DDSketch: A Fast and Fully-Mergeable Quantile Sketch with Relative-Error
+// Guarantees" (Masson et al., VLDB 2019).
+//
+// Samples are counted in logarithmically sized buckets, so every quantile is
+// within relativeAccuracy of the true sample value: with 0.01, a true P99 of
+// 200ms is reported between 198ms and 202ms, whatever the distribution.
+//
+// Add is O(1) and Quantile is O(bins). Memory is bounded by 1024 buckets;
+// beyond that the lowest buckets are collapsed, which only loses accuracy on
+// the smallest samples.
+//
+// To follow changing latency, every count is halved each window samples, so
+// the sketch weighs recent samples most and mostly reflects the last
+// 2*window of them. A window of zero or less never forgets.
+type DDSketch struct {
+	gamma    float64
+	logGamma float64
+	window   int
+
+	// bins[i] counts samples in bucket offset+i
+	bins   []float64
+	offset int
+	zero   float64
+	count  float64
+	added  int
+}
+
+// NewDDSketch creates a DDSketch. relativeAccuracy is clamped to
+// [0.0001, 0.5]; 0.01 is a good default.
+func NewDDSketch(relativeAccuracy float64, window int) *DDSketch {
+	relativeAccuracy = min(max(relativeAccuracy, 0.0001), 0.5)
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &DDSketch{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		window:   window,
+	}
+}
+
+// Add implements QuantileEstimator.
+func (s *DDSketch) Add(value time.Duration) {
+	if s.window > 0 && s.added >= s.window {
+		s.halve()
+	}
+	s.added++
+	s.count++
+
+	if value <= 0 {
+		s.zero++
+		return
+	}
+
+	i := int(math.Ceil(math.Log(float64(value)) / s.logGamma))
+	switch {
+	case len(s.bins) == 0:
+		s.offset = i
+		s.bins = append(s.bins, 0)
+	case i < s.offset:
+		grow := s.offset - i
+		if len(s.bins)+grow > ddSketchMaxBins {
+			// Collapse into the lowest bucket
+			i = s.offset
+			break
+		}
+		for range grow {
+			s.bins = append(s.bins, 0)
+		}
+		copy(s.bins[grow:], s.bins)
+		clear(s.bins[:grow])
+		s.offset = i
+	case i >= s.offset+len(s.bins):
+		for range i - s.offset - len(s.bins) + 1 {
+			s.bins = append(s.bins, 0)
+		}
+		if extra := len(s.bins) - ddSketchMaxBins; extra > 0 {
+			for _, c := range s.bins[:extra] {
+				s.bins[extra] += c
+			}
+			copy(s.bins, s.bins[extra:])
+			s.bins = s.bins[:ddSketchMaxBins]
+			s.offset += extra
+		}
+	}
+	s.bins[i-s.offset]++
+}
+
+// Quantile implements QuantileEstimator.
+func (s *DDSketch) Quantile(q float64) time.Duration {
+	if s.count <= 0 {
+		return 0
+	}
+
+	rank := min(max(q, 0), 1) * (s.count - 1)
+	if rank < s.zero {
+		return 0
+	}
+
+	seen := s.zero
+	for i, c := range s.bins {
+		seen += c
+		if seen > rank {
+			return s.value(s.offset + i)
+		}
+	}
+	return s.value(s.offset + len(s.bins) - 1)
+}
+
+// Count implements QuantileEstimator. After halving it is the weighted count.
+func (s *DDSketch) Count() int {
+	return int(math.Round(s.count))
+}
+
+// Scale implements QuantileEstimator. Buckets shift by a whole number of
+// buckets, so scaled samples may lose up to relativeAccuracy more.
+func (s *DDSketch) Scale(factor float64) {
+	if factor <= 0 {
+		s.bins = s.bins[:0]
+		s.zero = s.count
+		return
+	}
+	s.offset += int(math.Round(math.Log(factor) / s.logGamma))
+}
+
+// value returns the estimate for bucket i, which holds samples in
+// (gamma^(i-1), gamma^i].
+func (s *DDSketch) value(i int) time.Duration {
+	return time.Duration(2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1))
+}
+
+func (s *DDSketch) halve() {
+	for i := range s.bins {
+		s.bins[i] /= 2
+	}
+	s.zero /= 2
+	s.count /= 2
+	s.added = 0
+}
@@ -0,0 +1,42 @@
+package floodgate
+
+import (
+	"context"
+	"time"
+)
+
+// Percentile returns the tracked quantile closest to q from above, e.g. P99
+// for 0.98 when only P50, P95 and P99 are tracked, or the highest tracked
+// quantile if none is above q.
+func (stats Stats) Percentile(q float64) time.Duration {
+	if len(stats.Quantiles) == 0 {
+		switch {
+		case q <= 0.5:
+			return stats.P50
+		case q <= 0.95:
+			return stats.P95
+		default:
+			return stats.P99
+		}
+	}
+
+	for _, qv := range stats.Quantiles {
+		if qv.Quantile >= q-quantileEpsilon {
+			return qv.Value
+		}
+	}
+	return stats.Quantiles[len(stats.Quantiles)-1].Value
+}
+
+// deadlineTooShort reports whether ctx's remaining deadline is shorter than
+// the latency estimate plus margin, i.e. the request would almost certainly
+// time out. Requests without a deadline or keys without an estimate yet are
+// never too short.
+func deadlineTooShort(ctx context.Context, estimate, margin time.Duration) (remaining time.Duration, tooShort bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok || estimate <= 0 {
+		return 0, false
+	}
+	remaining = time.Until(deadline)
+	return remaining, remaining < estimate+margin
+}
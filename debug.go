@@ -0,0 +1,219 @@
+package floodgate
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugKey is the live state of a single tracked method or route.
+type DebugKey struct {
+	Key          string
+	Stats        Stats
+	Level        Level
+	CircuitState CircuitState
+
+	// Stream is the per-message state of the key's streams, or nil if the
+	// key has had none.
+	Stream *DebugStream
+
+	// LastUpdate is when the key last completed a request. It is zero if no
+	// request has completed yet.
+	LastUpdate time.Time
+}
+
+// DebugStream is the per-message latency of a key's streams, tracked apart
+// from its request latency.
+type DebugStream struct {
+	Stats Stats
+	Level Level
+}
+
+// debugStats renders Stats in JSON with durations in nanoseconds.
+type debugStats struct {
+	EMA          int64   `json:"ema_ns"`
+	Slope        int64   `json:"slope_ns"`
+	Drift        int64   `json:"drift_ns"`
+	PercentDrift float64 `json:"percent_drift"`
+	P50          int64   `json:"p50_ns"`
+	P95          int64   `json:"p95_ns"`
+	P99          int64   `json:"p99_ns"`
+	Count        int     `json:"count"`
+	Min          int64   `json:"min_ns"`
+	Max          int64   `json:"max_ns"`
+	StdDev       int64   `json:"stddev_ns"`
+	RPS          float64 `json:"rps"`
+}
+
+func newDebugStats(stats Stats) debugStats {
+	return debugStats{
+		EMA:          int64(stats.EMA),
+		Slope:        int64(stats.Slope),
+		Drift:        int64(stats.Drift),
+		PercentDrift: stats.PercentDrift,
+		P50:          int64(stats.P50),
+		P95:          int64(stats.P95),
+		P99:          int64(stats.P99),
+		Count:        stats.Count,
+		Min:          int64(stats.Min),
+		Max:          int64(stats.Max),
+		StdDev:       int64(stats.StdDev),
+		RPS:          stats.RPS,
+	}
+}
+
+// debugStreamJSON is the JSON form of a DebugStream.
+type debugStreamJSON struct {
+	Level string `json:"level"`
+	debugStats
+}
+
+// MarshalJSON renders durations in nanoseconds and enums as their names.
+func (k DebugKey) MarshalJSON() ([]byte, error) {
+	var stream *debugStreamJSON
+	if k.Stream != nil {
+		stream = &debugStreamJSON{
+			Level:      k.Stream.Level.String(),
+			debugStats: newDebugStats(k.Stream.Stats),
+		}
+	}
+
+	return json.Marshal(struct {
+		Key          string `json:"key"`
+		Level        string `json:"level"`
+		CircuitState string `json:"circuit_state"`
+		debugStats
+		Stream     *debugStreamJSON `json:"stream,omitempty"`
+		LastUpdate time.Time        `json:"last_update,omitzero"`
+	}{
+		Key:          k.Key,
+		Level:        k.Level.String(),
+		CircuitState: k.CircuitState.String(),
+		debugStats:   newDebugStats(k.Stats),
+		Stream:       stream,
+		LastUpdate:   k.LastUpdate,
+	})
+}
+
+// DebugSnapshot is the live state of a middleware.
+type DebugSnapshot struct {
+	Keys []DebugKey `json:"keys"`
+
+	DispatcherDropped  uint64  `json:"dispatcher_dropped"`
+	DispatcherTotal    uint64  `json:"dispatcher_total"`
+	DispatcherDropRate float64 `json:"dispatcher_drop_rate"`
+}
+
+// DebugHandler is an http.Handler that shows the live tracker state of every
+// registered middleware. It serves an HTML table by default and JSON when the
+// request has ?format=json or accepts application/json.
+//
+// Example:
+//
+//	debug := floodgate.NewDebugHandler()
+//	cfg.Debug = debug
+//	mux.Handle("/debug/floodgate", debug)
+//
+// The handler exposes route names and latencies, so mount it on an internal
+// listener or behind authentication.
+type DebugHandler struct {
+	mu      sync.RWMutex
+	sources []debugSource
+}
+
+type debugSource struct {
+	name     string
+	snapshot func() DebugSnapshot
+}
+
+// NewDebugHandler creates an empty debug handler.
+func NewDebugHandler() *DebugHandler {
+	return &DebugHandler{}
+}
+
+// Register adds a middleware's state under name. snapshot is called on every
+// request to the handler. The gRPC interceptor and HTTP middleware register
+// themselves when their Config.Debug is set.
+func (h *DebugHandler) Register(name string, snapshot func() DebugSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sources = append(h.sources, debugSource{name: name, snapshot: snapshot})
+}
+
+// debugSection is a named snapshot as served by the handler.
+type debugSection struct {
+	Name string `json:"name"`
+	DebugSnapshot
+}
+
+// sections returns the current state of every registered middleware, with
+// keys sorted by name.
+func (h *DebugHandler) sections() []debugSection {
+	h.mu.RLock()
+	sources := slices.Clone(h.sources)
+	h.mu.RUnlock()
+
+	sections := make([]debugSection, 0, len(sources))
+	for _, source := range sources {
+		snapshot := source.snapshot()
+		slices.SortFunc(snapshot.Keys, func(a, b DebugKey) int {
+			return strings.Compare(a.Key, b.Key)
+		})
+		sections = append(sections, debugSection{Name: source.name, DebugSnapshot: snapshot})
+	}
+	return sections
+}
+
+// ServeHTTP implements http.Handler.
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sections := h.sections()
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(sections)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = debugTemplate.Execute(w, sections)
+}
+
+var debugTemplate = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"since": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Millisecond).String() + " ago"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>floodgate</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>floodgate</h1>
+{{range .}}
+<h2>{{.Name}}</h2>
+<p>Dispatcher: {{.DispatcherDropped}} dropped of {{.DispatcherTotal}} ({{printf "%.2f" .DispatcherDropRate}}%)</p>
+<table>
+<tr><th>Key</th><th>Level</th><th>Circuit</th><th>EMA</th><th>Slope</th><th>Drift</th><th>P50</th><th>P95</th><th>P99</th><th>Count</th><th>Min</th><th>Max</th><th>StdDev</th><th>RPS</th><th>Last update</th></tr>
+{{range .Keys}}<tr><td>{{.Key}}</td><td>{{.Level}}</td><td>{{.CircuitState}}</td><td>{{.Stats.EMA}}</td><td>{{.Stats.Slope}}</td><td>{{.Stats.Drift}}</td><td>{{.Stats.P50}}</td><td>{{.Stats.P95}}</td><td>{{.Stats.P99}}</td><td>{{.Stats.Count}}</td><td>{{.Stats.Min}}</td><td>{{.Stats.Max}}</td><td>{{.Stats.StdDev}}</td><td>{{printf "%.1f" .Stats.RPS}}</td><td>{{since .LastUpdate}}</td></tr>
+{{$key := .Key}}{{with .Stream}}<tr><td>{{$key}} (streams)</td><td>{{.Level}}</td><td></td><td>{{.Stats.EMA}}</td><td>{{.Stats.Slope}}</td><td>{{.Stats.Drift}}</td><td>{{.Stats.P50}}</td><td>{{.Stats.P95}}</td><td>{{.Stats.P99}}</td><td>{{.Stats.Count}}</td><td>{{.Stats.Min}}</td><td>{{.Stats.Max}}</td><td>{{.Stats.StdDev}}</td><td>{{printf "%.1f" .Stats.RPS}}</td><td></td></tr>
+{{end}}{{else}}<tr><td colspan="15">No tracked keys</td></tr>
+{{end}}</table>
+{{else}}
+<p>No middleware registered.</p>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,85 @@
+package floodgate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugHandler(t *testing.T) {
+	debug := NewDebugHandler()
+	debug.Register("test", func() DebugSnapshot {
+		return DebugSnapshot{
+			Keys: []DebugKey{
+				{
+					Key:          "/svc/Slow",
+					Stats:        Stats{P95: 3 * time.Second, Count: 42, Max: 7 * time.Second, RPS: 12.5},
+					Level:        Critical,
+					CircuitState: StateOpen,
+					Stream:       &DebugStream{Stats: Stats{P95: 5 * time.Second}, Level: Emergency},
+				},
+				{Key: "/svc/Fast", Stats: Stats{P95: time.Millisecond}, Level: Normal, LastUpdate: time.Now()},
+			},
+			DispatcherDropped: 1,
+			DispatcherTotal:   10,
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		debug.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/floodgate?format=json", nil))
+
+		var sections []struct {
+			Name              string `json:"name"`
+			DispatcherDropped uint64 `json:"dispatcher_dropped"`
+			Keys              []struct {
+				Key          string `json:"key"`
+				Level        string `json:"level"`
+				CircuitState string `json:"circuit_state"`
+				P95          int64  `json:"p95_ns"`
+				Stream       *struct {
+					Level string `json:"level"`
+					P95   int64  `json:"p95_ns"`
+				} `json:"stream"`
+			} `json:"keys"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&sections); err != nil {
+			t.Fatalf("Failed to decode JSON: %v", err)
+		}
+		if len(sections) != 1 || sections[0].Name != "test" || sections[0].DispatcherDropped != 1 {
+			t.Fatalf("Unexpected sections: %+v", sections)
+		}
+
+		keys := sections[0].Keys
+		if len(keys) != 2 || keys[0].Key != "/svc/Fast" {
+			t.Fatalf("Expected keys sorted by name, got %+v", keys)
+		}
+		if keys[1].Level != "critical" || keys[1].CircuitState != "open" || keys[1].P95 != int64(3*time.Second) {
+			t.Errorf("Unexpected key state: %+v", keys[1])
+		}
+		if keys[0].Stream != nil {
+			t.Errorf("Expected no stream state for a key without streams, got %+v", keys[0].Stream)
+		}
+		if s := keys[1].Stream; s == nil || s.Level != "emergency" || s.P95 != int64(5*time.Second) {
+			t.Errorf("Unexpected stream state: %+v", s)
+		}
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		debug.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/floodgate", nil))
+
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("Expected HTML content type, got %q", ct)
+		}
+		body := w.Body.String()
+		for _, want := range []string{"/svc/Slow", "critical", "open", "3s", "never", "/svc/Slow (streams)", "emergency", "5s", "<td>42</td>", "7s", "12.5"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected HTML to contain %q", want)
+			}
+		}
+	})
+}
@@ -25,9 +25,12 @@ func main() {
 	cfg.Thresholds.P95Critical = 1 * time.Second
 	cfg.Thresholds.EMAWarning = 200 * time.Millisecond
 
-	// Create gRPC server with backpressure interceptor
+	// Create gRPC server with backpressure interceptors. Unary and streaming
+	// RPCs share the same per-method trackers and circuit breakers.
+	unary, stream := bpgrpc.ServerInterceptors(ctx, cfg)
 	server := grpc.NewServer(
-		grpc.UnaryInterceptor(bpgrpc.UnaryServerInterceptor(ctx, cfg)),
+		grpc.UnaryInterceptor(unary),
+		grpc.StreamInterceptor(stream),
 	)
 
 	// Register your services here
@@ -11,6 +11,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/mushtruk/floodgate"
 	floodgatehttp "github.com/mushtruk/floodgate/http"
 )
 
@@ -26,6 +27,10 @@ func main() {
 	cfg.Thresholds.P95Critical = 200 * time.Millisecond
 	cfg.Thresholds.P99Emergency = 300 * time.Millisecond
 
+	// Expose live tracker state, untracked by the middleware itself
+	cfg.Debug = floodgate.NewDebugHandler()
+	cfg.SkipPaths = append(cfg.SkipPaths, "/debug/")
+
 	// Create router
 	mux := http.NewServeMux()
 
@@ -35,6 +40,8 @@ func main() {
 		fmt.Fprintf(w, "OK")
 	})
 
+	mux.Handle("/debug/floodgate", cfg.Debug)
+
 	mux.HandleFunc("/api/fast", func(w http.ResponseWriter, r *http.Request) {
 		// Fast endpoint
 		time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
@@ -74,6 +81,7 @@ func main() {
 		log.Printf("  GET /api/fast      - Fast endpoint (~10ms)")
 		log.Printf("  GET /api/slow      - Slow endpoint (50-250ms)")
 		log.Printf("  GET /api/variable  - Variable latency (0-300ms)")
+		log.Printf("  GET /debug/floodgate - Live tracker state (HTML, ?format=json)")
 		log.Printf("")
 		log.Printf("Try: curl http://localhost:8080/api/slow")
 		log.Printf("Load test: while true; do curl http://localhost:8080/api/slow & done")
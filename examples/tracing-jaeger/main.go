@@ -103,10 +103,11 @@ func main() {
 
 	// Create tracer for application spans
 	tracer := otel.Tracer("floodgate-demo")
-	_ = tracing.NewTracer(tracer) // Available for future middleware integration
 
-	// Configure backpressure (HTTP spans created automatically by otelhttp)
+	// Configure backpressure (HTTP spans created automatically by otelhttp,
+	// admission decisions recorded as floodgate.backpressure child spans)
 	cfg := bphttp.DefaultConfig()
+	cfg.Tracer = tracing.NewTracer(tracer)
 	cfg.Thresholds = floodgate.Thresholds{
 		P99Emergency: 500 * time.Millisecond,
 		P95Critical:  200 * time.Millisecond,
@@ -0,0 +1,1049 @@
+package floodgate
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// GateConfig holds the transport-independent configuration of a Gate. The gRPC
+// interceptor and HTTP middleware embed it in their own Config.
+type GateConfig struct {
+	CacheSize            int
+	CacheTTL             time.Duration
+	DispatcherBufferSize int
+	Thresholds           Thresholds
+	EnableMetrics        bool
+	MetricsInterval      time.Duration
+
+	// KeyName names keys in log attributes, e.g. "method" or "route".
+	// If empty, uses "key".
+	KeyName string
+
+	// LevelPolicy decides the backpressure level from a key's stats.
+	// If nil, uses ThresholdPolicy with Thresholds.
+	LevelPolicy LevelPolicy
+
+	// ExitThresholds are the thresholds stats must fall below before a key's
+	// level de-escalates. Keeping them below Thresholds stops a key hovering
+	// around a threshold from flapping. If zero, uses Thresholds scaled by
+	// DefaultExitRatio. Ignored when LevelPolicy is set.
+	ExitThresholds Thresholds
+
+	// Resources, if set, combines the process-wide resource level with every
+	// key's latency level; the more severe one wins. One monitor can be
+	// shared by several gates.
+	Resources *ResourceMonitor
+
+	// LevelMinDwell is the minimum time a key stays at a level before it
+	// de-escalates. Zero de-escalates as soon as stats allow.
+	LevelMinDwell time.Duration
+
+	// Circuit breaker configuration. CircuitBreakerMode selects per-key,
+	// global or hybrid breakers; in hybrid mode every key is rejected while
+	// CircuitBreakerHybridThreshold per-key breakers are open.
+	CircuitBreakerMode             CircuitMode
+	CircuitBreakerHybridThreshold  int
+	CircuitBreakerMaxFailures      int
+	CircuitBreakerTimeout          time.Duration
+	CircuitBreakerSuccessThreshold int
+
+	// Tracker configuration per key
+	TrackerAlpha      float32
+	TrackerWindowSize int
+	TrackerSampleSize int
+
+	// TrackerDecayHalfLife makes stats decay once no samples arrive, so a
+	// key that is being rejected recovers without waiting for CacheTTL.
+	// Zero disables decay.
+	TrackerDecayHalfLife time.Duration
+
+	// TrackerTimeWindow makes percentiles and trend describe the last window
+	// of traffic rather than the last TrackerSampleSize requests. Zero uses a
+	// sample-count window.
+	TrackerTimeWindow time.Duration
+
+	// TrackerQuantiles are quantiles tracked per key in addition to P50, P95
+	// and P99, e.g. 0.9 and 0.999. They can be used in Thresholds.Quantiles
+	// and are reported through Metrics and the Tracer.
+	TrackerQuantiles []float64
+
+	// TrackerQuantileEstimator creates the percentile estimator for each key,
+	// e.g. a DDSketch, in place of the exact TrackerSampleSize sample buffer.
+	// If nil, percentiles are exact.
+	TrackerQuantileEstimator func() QuantileEstimator
+
+	// ProbeRatio is the fraction of requests admitted at Critical and Emergency
+	// levels so the tracker keeps seeing fresh latency. Zero disables probing.
+	ProbeRatio float64
+
+	// Shedding rejects a fraction of requests at Moderate and Critical,
+	// instead of rejecting all of them at Critical. Shed requests do not trip
+	// the circuit breaker. Emergency still rejects every request and counts
+	// towards the breaker. If nil, rejection is all-or-nothing.
+	Shedding ShedPolicy
+
+	// DeadlinePercentile enables deadline-aware admission: a request whose
+	// context deadline leaves less time than this percentile of its key's
+	// latency plus DeadlineMargin is rejected with RejectDeadline instead of
+	// running only to time out. See Stats.Percentile for the supported values.
+	// Zero disables the check.
+	DeadlinePercentile float64
+
+	// DeadlineMargin is added to the latency estimate, e.g. to leave time
+	// for the response to reach the client.
+	DeadlineMargin time.Duration
+
+	// TenantCacheSize bounds the per-tenant state kept for fairness. Requests
+	// carry a tenant through WithTenant; once a key reaches Moderate, tenants
+	// holding more than their fair share of the key's in-flight requests, or
+	// of its recent load (the latency of requests completed over the last
+	// ten seconds or so), are rejected with RejectTenant before other tenants
+	// are affected. Streams count toward in-flight requests only.
+	// If zero, uses CacheSize.
+	TenantCacheSize int
+
+	// Brownout admits requests at Moderate and Critical with Decision.Degrade
+	// set instead of rejecting them, so handlers can degrade gracefully.
+	// Requests are still rejected at Emergency and while the circuit is open.
+	// Tiers shed below Critical are still shed from their Criticality.ShedLevel.
+	// Handlers read the decision with FromContext.
+	Brownout bool
+
+	// Shadow runs every check but only enforces ShadowEnforceRatio of the
+	// rejections. Requests that would have been rejected are logged, recorded
+	// with ResultWouldReject and let through. Levels and hooks keep working
+	// as usual, so they can be observed before rejection is switched on.
+	// Rejections that are not enforced count towards a separate shadow
+	// breaker per key, so they never open the real circuit breaker.
+	Shadow bool
+
+	// ShadowEnforceRatio is the fraction of rejections enforced in shadow
+	// mode, for a gradual rollout from 0 (log only) to 1 (enforce all).
+	ShadowEnforceRatio float64
+
+	// ConcurrencyLimiter creates the adaptive concurrency limiter for each key.
+	// Requests over the limit are rejected like critical backpressure. Requests
+	// admitted with AdmitStream are not limited.
+	// If nil, concurrency is not limited.
+	//
+	// Example:
+	//
+	//	cfg.ConcurrencyLimiter = func() *floodgate.Limiter {
+	//	    return floodgate.NewLimiter(floodgate.NewGradient2Limit(), 20, 1, 1000)
+	//	}
+	ConcurrencyLimiter func() *Limiter
+
+	// Retry-after hints (seconds)
+	RetryAfterEmergency int
+	RetryAfterCritical  int
+	RetryAfterCircuit   int
+
+	// Logger for backpressure events. If nil, uses DefaultLogger.
+	Logger Logger
+
+	// Metrics collector for observability. If nil, uses NoOpMetrics (disabled).
+	Metrics MetricsCollector
+
+	// Tracer records every admission decision as a span. If nil, uses NoOpTracer (disabled).
+	Tracer Tracer
+
+	// OnLevelChange is called once per level transition of a key, with the
+	// stats that caused it. It runs on the request path, so it should return
+	// quickly. If nil, level changes are only logged.
+	OnLevelChange func(key string, from, to Level, stats Stats)
+
+	// OnCircuitStateChange is called once per state transition of a key's
+	// circuit breaker. In CircuitGlobal mode key is empty.
+	OnCircuitStateChange func(key string, from, to CircuitState)
+}
+
+// DefaultGateConfig returns sensible default configuration.
+func DefaultGateConfig() GateConfig {
+	return GateConfig{
+		CacheSize:            512,
+		CacheTTL:             2 * time.Minute,
+		DispatcherBufferSize: 1024,
+		Thresholds:           DefaultThresholds(),
+		EnableMetrics:        true,
+		MetricsInterval:      1 * time.Minute,
+		LevelMinDwell:        2 * time.Second,
+		TenantCacheSize:      4096,
+
+		CircuitBreakerMode:             CircuitPerKey,
+		CircuitBreakerHybridThreshold:  3,
+		CircuitBreakerMaxFailures:      3,
+		CircuitBreakerTimeout:          30 * time.Second,
+		CircuitBreakerSuccessThreshold: 5,
+
+		TrackerAlpha:      0.1,
+		TrackerWindowSize: 50,
+		TrackerSampleSize: 200,
+
+		TrackerDecayHalfLife: 10 * time.Second,
+		ProbeRatio:           0.01,
+
+		RetryAfterEmergency: 10,
+		RetryAfterCritical:  5,
+		RetryAfterCircuit:   30,
+
+		Logger:  NewDefaultLogger(),
+		Metrics: &NoOpMetrics{}, // Disabled by default
+	}
+}
+
+// Rejection identifies why a Gate rejected a request.
+type Rejection string
+
+const (
+	RejectCircuitOpen Rejection = "circuit breaker open"
+	RejectShed        Rejection = "load shedding"
+	RejectEmergency   Rejection = "emergency backpressure"
+	RejectCritical    Rejection = "critical backpressure"
+	RejectLimited     Rejection = "concurrency limit reached"
+
+	// RejectCriticality is a request of a low tier shed before its key
+	// reached Critical. See Criticality.ShedLevel.
+	RejectCriticality Rejection = "criticality shedding"
+
+	// RejectTenant is a request from a tenant holding more than its fair
+	// share of an overloaded key's in-flight requests.
+	RejectTenant Rejection = "tenant over fair share"
+
+	// RejectDeadline is a request whose deadline is too short for it to
+	// finish. Retrying with the same deadline will not help.
+	RejectDeadline Rejection = "deadline too short"
+
+	// RejectRetryAfter is used by clients while an upstream's Retry-After
+	// has not yet passed.
+	RejectRetryAfter Rejection = "upstream retry-after"
+
+	// RejectThrottled is used by clients that throttle themselves with an
+	// AdaptiveThrottle.
+	RejectThrottled Rejection = "adaptive throttling"
+)
+
+// ErrOverloaded is returned by Gate.Admit when a request is rejected.
+// Transports map it to their own status, e.g. 503 with a Retry-After header.
+type ErrOverloaded struct {
+	Key       string
+	Level     Level
+	Rejection Rejection
+
+	// RetryAfter is how long the client should wait before retrying.
+	RetryAfter time.Duration
+}
+
+func (e ErrOverloaded) Error() string {
+	return "floodgate: " + e.Key + " rejected: " + string(e.Rejection)
+}
+
+// Gate is the transport-independent admission engine behind the gRPC
+// interceptor and HTTP middleware. It tracks latency per key (method, route,
+// topic, job type...) and decides whether each request may proceed.
+//
+// Example:
+//
+//	gate := floodgate.NewGate(ctx, floodgate.DefaultGateConfig())
+//
+//	decision, err := gate.Admit(ctx, "orders-topic")
+//	if err != nil {
+//	    return err // pause or requeue
+//	}
+//	start := time.Now()
+//	err = process(msg)
+//	decision.Done(time.Since(start), err)
+type Gate struct {
+	cfg        GateConfig
+	keyName    string
+	policy     LevelPolicy
+	exitPolicy LevelPolicy // nil when policy is used in both directions
+	circuits   *CircuitGroup
+	registry   *expirable.LRU[string, *gateState]
+	tenants    *expirable.LRU[tenantID, *tenantState]
+	dispatcher *Dispatcher[time.Duration]
+	logger     Logger
+	metrics    MetricsCollector
+	tracer     Tracer
+
+	// concurrencyMetrics is metrics if it records concurrency limits, or nil.
+	concurrencyMetrics ConcurrencyMetricsCollector
+
+	// statsMetrics is metrics if it records tracked stats, or nil.
+	statsMetrics StatsMetricsCollector
+}
+
+// gateState holds the per-key trackers, circuit breaker and limiter.
+type gateState struct {
+	tracker Tracker[time.Duration, Stats]
+	breaker *CircuitBreaker
+	limiter *Limiter // nil when concurrency limiting is disabled
+
+	// shadowBreaker records the checks that are not enforced in shadow mode,
+	// or is nil outside it.
+	shadowBreaker *CircuitBreaker
+
+	// level applies hysteresis to the level computed from tracker
+	level LevelState
+
+	// lastUpdate is when the key last completed a request, in Unix nanoseconds.
+	lastUpdate atomic.Int64
+
+	// tenantInFlight and activeTenants count in-flight requests with a
+	// tenant and the tenants they belong to, for fairness.
+	tenantInFlight atomic.Int64
+	activeTenants  atomic.Int64
+	tenantLoads    tenantLoads
+
+	// streams tracks the per-message latency of streams separately from
+	// tracker, so that quick message hand-offs do not dilute request latency.
+	// New streams are held back by both levels. It is created by the first
+	// stream.
+	streamsOnce sync.Once
+	hasStreams  atomic.Bool
+	streams     Tracker[time.Duration, Stats]
+	streamLevel LevelState
+}
+
+// streamTracker returns the per-message tracker of the key's streams,
+// creating it on first use.
+func (g *Gate) streamTracker(state *gateState) Tracker[time.Duration, Stats] {
+	state.streamsOnce.Do(func() {
+		state.streams = g.newTracker()
+		state.hasStreams.Store(true)
+	})
+	return state.streams
+}
+
+// peekStreams returns the per-message tracker of the key's streams, or nil
+// if the key has had none.
+func (s *gateState) peekStreams() Tracker[time.Duration, Stats] {
+	if !s.hasStreams.Load() {
+		return nil
+	}
+	return s.streams
+}
+
+// NewGate creates a gate. Background work stops when ctx is cancelled.
+func NewGate(ctx context.Context, cfg GateConfig) *Gate {
+	circuits := NewCircuitGroup(
+		cfg.CircuitBreakerMode,
+		cfg.CircuitBreakerHybridThreshold,
+		cfg.CircuitBreakerMaxFailures,
+		cfg.CircuitBreakerTimeout,
+		cfg.CircuitBreakerSuccessThreshold,
+	)
+	if cfg.OnCircuitStateChange != nil {
+		circuits.OnStateChange(cfg.OnCircuitStateChange)
+	}
+
+	// Use provided metrics or no-op
+	metrics := cfg.Metrics
+	if metrics == nil {
+		metrics = &NoOpMetrics{}
+	}
+	evictionMetrics, _ := metrics.(EvictionMetricsCollector)
+
+	registry := expirable.NewLRU[string, *gateState](
+		cfg.CacheSize,
+		func(key string, _ *gateState) {
+			circuits.Forget(key)
+			if evictionMetrics != nil {
+				evictionMetrics.RecordEviction(key)
+			}
+		},
+		cfg.CacheTTL,
+	)
+
+	tenantCacheSize := cfg.TenantCacheSize
+	if tenantCacheSize <= 0 {
+		tenantCacheSize = cfg.CacheSize
+	}
+	tenants := expirable.NewLRU[tenantID, *tenantState](tenantCacheSize, nil, cfg.CacheTTL)
+
+	dispatcher := NewDispatcher[time.Duration](ctx, cfg.DispatcherBufferSize)
+
+	keyName := cfg.KeyName
+	if keyName == "" {
+		keyName = "key"
+	}
+
+	// Use provided logger or default
+	logger := cfg.Logger
+	if logger == nil {
+		logger = NewDefaultLogger()
+	}
+
+	// Use provided tracer or no-op
+	tracer := cfg.Tracer
+	if tracer == nil {
+		tracer = NoOpTracer{}
+	}
+
+	// Use provided level policy or thresholds
+	policy, exitPolicy := cfg.LevelPolicy, LevelPolicy(nil)
+	if policy == nil {
+		policy = ThresholdPolicy{Thresholds: cfg.Thresholds}
+
+		exitThresholds := cfg.ExitThresholds
+		if exitThresholds.isZero() {
+			exitThresholds = cfg.Thresholds.Scale(DefaultExitRatio)
+		}
+		exitPolicy = ThresholdPolicy{Thresholds: exitThresholds}
+	}
+	if cfg.Resources != nil {
+		policy = CompositePolicy{policy, cfg.Resources}
+		if exitPolicy != nil {
+			exitPolicy = CompositePolicy{exitPolicy, cfg.Resources}
+		}
+	}
+
+	g := &Gate{
+		cfg:        cfg,
+		keyName:    keyName,
+		policy:     policy,
+		exitPolicy: exitPolicy,
+		circuits:   circuits,
+		registry:   registry,
+		tenants:    tenants,
+		dispatcher: dispatcher,
+		logger:     logger,
+		metrics:    metrics,
+		tracer:     tracer,
+	}
+	g.concurrencyMetrics, _ = metrics.(ConcurrencyMetricsCollector)
+	g.statsMetrics, _ = metrics.(StatsMetricsCollector)
+
+	// Periodic metrics
+	if cfg.EnableMetrics {
+		go g.reportMetrics(ctx)
+	}
+
+	return g
+}
+
+func (g *Gate) reportMetrics(ctx context.Context) {
+	ticker := time.NewTicker(g.cfg.MetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cacheLen := g.registry.Len()
+			dropRate := g.dispatcher.DropRate()
+
+			// Record cache and dispatcher metrics
+			g.metrics.RecordCacheSize(cacheLen)
+			g.metrics.RecordDispatcherStats(g.dispatcher.DroppedCount(), g.dispatcher.TotalCount())
+
+			if g.statsMetrics != nil {
+				for _, key := range g.registry.Keys() {
+					if state, ok := g.registry.Peek(key); ok {
+						g.statsMetrics.RecordStats(key, state.tracker.Value())
+					}
+				}
+			}
+
+			circuitsOpen := 0
+			for _, state := range g.registry.Values() {
+				if state.breaker.State() == StateOpen {
+					circuitsOpen++
+				}
+			}
+
+			if cacheLen > 0 || dropRate > 0 {
+				g.logger.InfoContext(ctx, "backpressure metrics",
+					"cache_used", cacheLen,
+					"cache_size", g.cfg.CacheSize,
+					"cache_pct", float64(cacheLen)/float64(g.cfg.CacheSize)*100,
+					"drops", g.dispatcher.DroppedCount(),
+					"total", g.dispatcher.TotalCount(),
+					"drop_rate", dropRate,
+					"circuit_mode", g.circuits.Mode(),
+					"circuits_open", circuitsOpen)
+			}
+		}
+	}
+}
+
+// Snapshot returns the live state of every tracked key, e.g. for a DebugHandler:
+//
+//	debug.Register("kafka", gate.Snapshot)
+func (g *Gate) Snapshot() DebugSnapshot {
+	snapshot := DebugSnapshot{
+		DispatcherDropped:  g.dispatcher.DroppedCount(),
+		DispatcherTotal:    g.dispatcher.TotalCount(),
+		DispatcherDropRate: g.dispatcher.DropRate(),
+	}
+	for _, key := range g.registry.Keys() {
+		state, ok := g.registry.Peek(key)
+		if !ok {
+			continue
+		}
+		debugKey := DebugKey{
+			Key:          key,
+			Stats:        state.tracker.Value(),
+			Level:        state.level.Level(),
+			CircuitState: state.breaker.State(),
+		}
+		if streams := state.peekStreams(); streams != nil {
+			debugKey.Stream = &DebugStream{
+				Stats: streams.Value(),
+				Level: state.streamLevel.Level(),
+			}
+		}
+		if nanos := state.lastUpdate.Load(); nanos != 0 {
+			debugKey.LastUpdate = time.Unix(0, nanos)
+		}
+		snapshot.Keys = append(snapshot.Keys, debugKey)
+	}
+	return snapshot
+}
+
+// state returns the tracked state for key, creating it on first use.
+func (g *Gate) state(key string) *gateState {
+	state, ok := g.registry.Get(key)
+	if !ok {
+		state = &gateState{
+			tracker: g.newTracker(),
+			breaker: g.circuits.Breaker(key),
+		}
+		if g.cfg.ConcurrencyLimiter != nil {
+			state.limiter = g.cfg.ConcurrencyLimiter()
+		}
+		if g.cfg.Shadow {
+			state.shadowBreaker = NewCircuitBreaker(g.cfg.CircuitBreakerMaxFailures, g.cfg.CircuitBreakerTimeout, g.cfg.CircuitBreakerSuccessThreshold)
+		}
+		g.registry.Add(key, state)
+	}
+	return state
+}
+
+// tenant returns the fairness state of tenant for key, creating it on first use.
+func (g *Gate) tenant(key, tenant string) *tenantState {
+	id := tenantID{key: key, tenant: tenant}
+	state, ok := g.tenants.Get(id)
+	if !ok {
+		state = &tenantState{}
+		g.tenants.Add(id, state)
+	}
+	return state
+}
+
+func (g *Gate) newTracker() Tracker[time.Duration, Stats] {
+	opts := []Option{
+		WithAlpha(g.cfg.TrackerAlpha),
+		WithWindowSize(g.cfg.TrackerWindowSize),
+		WithPercentiles(g.cfg.TrackerSampleSize),
+		WithDecay(g.cfg.TrackerDecayHalfLife),
+		WithTimeWindow(g.cfg.TrackerTimeWindow),
+		WithQuantiles(g.cfg.TrackerQuantiles...),
+	}
+	if g.cfg.TrackerQuantileEstimator != nil {
+		opts = append(opts, WithQuantileEstimator(g.cfg.TrackerQuantileEstimator()))
+	}
+	return NewTracker(opts...)
+}
+
+// Decision is the outcome of an admitted request. Done must be called exactly
+// once when the request completes.
+type Decision struct {
+	// Level is the backpressure level of the key when the request was admitted.
+	Level Level
+
+	// Reason explains Level.
+	Reason Reason
+
+	// Stats are the key's stats when the request was admitted.
+	Stats Stats
+
+	// Degrade reports that the request was admitted in brownout mode at a
+	// level that would otherwise reject it. Handlers should skip optional
+	// work such as recommendations, or serve cached results.
+	Degrade bool
+
+	// Brownout is a dial from 0 to 1 that rises with how far the key's
+	// latency is past its thresholds. Handlers can skip that fraction of
+	// their optional work.
+	Brownout float64
+
+	// Probe reports that the request was let through at Critical or Emergency
+	// so the tracker can observe recovery.
+	Probe bool
+
+	// Shadowed reports that the request would have been rejected but was let
+	// through in shadow mode.
+	Shadowed bool
+
+	// Criticality is the request tier, from WithCriticality.
+	Criticality Criticality
+
+	// Tenant is the tenant the request belongs to, from WithTenant.
+	Tenant string
+
+	ctx      context.Context
+	gate     *Gate
+	key      string
+	state    *gateState
+	stream   bool
+	acquired bool
+	tenant   *tenantState // nil when the request has no tenant
+}
+
+// Admit runs the circuit breaker, backpressure and concurrency checks for a
+// request to key. On rejection it returns an ErrOverloaded error and the
+// request must not run.
+func (g *Gate) Admit(ctx context.Context, key string) (Decision, error) {
+	return g.admit(ctx, key, false)
+}
+
+// AdmitStream runs the circuit breaker and backpressure checks once for a
+// long-lived request such as a gRPC stream. Streams are not concurrency
+// limited. Report per-message latency with Decision.Observe; it is tracked
+// separately from the key's request latency, and a new stream is held back
+// when either is overloaded. The duration passed to Done is not tracked, so
+// long streams do not look slow.
+func (g *Gate) AdmitStream(ctx context.Context, key string) (Decision, error) {
+	return g.admit(ctx, key, true)
+}
+
+func (g *Gate) admit(ctx context.Context, key string, stream bool) (Decision, error) {
+	state := g.state(key)
+
+	span := g.tracer.StartDecision(ctx, key)
+	defer span.End()
+
+	tier := CriticalityFromContext(ctx)
+
+	// In shadow mode only a fraction of rejections is enforced
+	enforce := !g.cfg.Shadow || chance(g.cfg.ShadowEnforceRatio)
+
+	level, reason, stats, probe, err := g.check(ctx, key, tier, stream, enforce, state, span)
+	if err != nil && enforce {
+		return Decision{}, err
+	}
+
+	decision := Decision{
+		Level:       level,
+		Reason:      reason,
+		Stats:       stats,
+		Brownout:    brownoutDial(stats, g.cfg.Thresholds),
+		Degrade:     g.cfg.Brownout && level >= Moderate,
+		Probe:       probe,
+		Criticality: tier,
+		Tenant:      TenantFromContext(ctx),
+		ctx:         ctx,
+		gate:        g,
+		key:         key,
+		state:       state,
+		stream:      stream,
+	}
+
+	// reject returns the error for an enforced rejection. In shadow mode it
+	// logs the rejection that would have happened and returns nil.
+	reject := func(rejection Rejection) error {
+		if enforce {
+			return g.reject(key, level, rejection)
+		}
+		g.logger.WarnContext(ctx, "backpressure would reject",
+			g.keyName, key,
+			"level", level,
+			"rejection", rejection)
+		decision.Shadowed = true
+		return nil
+	}
+
+	if err != nil {
+		_ = reject(err.(ErrOverloaded).Rejection)
+	}
+
+	// Shed tenants over their fair share first once the key is overloaded
+	var tenant *tenantState
+	if decision.Tenant != "" {
+		tenant = g.tenant(key, decision.Tenant)
+		inFlight := tenant.inFlight.Load()
+		if level >= Moderate && (overFairShare(inFlight, state.tenantInFlight.Load(), state.activeTenants.Load()) ||
+			state.tenantLoads.overFairShare(tenant, time.Now())) {
+			span.RecordDecision(stats, level, true)
+			g.logger.WarnContext(ctx, "tenant over fair share",
+				g.keyName, key,
+				"tenant", decision.Tenant,
+				"level", level,
+				"in_flight", inFlight,
+				"key_in_flight", state.tenantInFlight.Load())
+			g.recordRejection(ctx, RequestLabels{
+				Method:      key,
+				Level:       level,
+				Criticality: tier,
+				Result:      ResultShed,
+			}, enforce)
+			if err := reject(RejectTenant); err != nil {
+				return Decision{}, err
+			}
+		}
+	}
+
+	if g.cfg.DeadlinePercentile > 0 {
+		estimate := stats.Percentile(g.cfg.DeadlinePercentile)
+		if remaining, tooShort := deadlineTooShort(ctx, estimate, g.cfg.DeadlineMargin); tooShort {
+			span.RecordDecision(stats, level, true)
+			g.logger.WarnContext(ctx, "deadline too short",
+				g.keyName, key,
+				"remaining", remaining,
+				"estimate", estimate)
+			g.recordRejection(ctx, RequestLabels{
+				Method:      key,
+				Level:       level,
+				Criticality: tier,
+				Result:      ResultDeadline,
+			}, enforce)
+			if err := reject(RejectDeadline); err != nil {
+				return Decision{}, err
+			}
+		}
+	}
+
+	if !stream && state.limiter != nil {
+		if state.limiter.Acquire() {
+			decision.acquired = true
+		} else {
+			span.RecordDecision(stats, level, true)
+			g.logger.WarnContext(ctx, "concurrency limit reached",
+				g.keyName, key,
+				"limit", state.limiter.Limit())
+			g.recordRejection(ctx, RequestLabels{
+				Method:      key,
+				Level:       level,
+				Criticality: tier,
+				Result:      ResultLimited,
+			}, enforce)
+			if err := reject(RejectLimited); err != nil {
+				return Decision{}, err
+			}
+		}
+	}
+
+	if tenant != nil {
+		if tenant.inFlight.Add(1) == 1 {
+			state.activeTenants.Add(1)
+		}
+		state.tenantInFlight.Add(1)
+		decision.tenant = tenant
+	}
+
+	return decision, nil
+}
+
+// recordRejection records a rejected request, or in shadow mode one that
+// would have been rejected but was let through.
+func (g *Gate) recordRejection(ctx context.Context, labels RequestLabels, enforced bool) {
+	if !enforced {
+		labels.Result = ResultWouldReject
+		g.metrics.RecordRequest(ctx, labels, 0, false)
+		return
+	}
+	g.metrics.RecordRequest(ctx, labels, 0, true)
+}
+
+// reject builds the error for a rejected request.
+func (g *Gate) reject(key string, level Level, rejection Rejection) ErrOverloaded {
+	retryAfter := g.cfg.RetryAfterCritical
+	switch rejection {
+	case RejectDeadline:
+		retryAfter = 0
+	case RejectCircuitOpen:
+		retryAfter = g.cfg.RetryAfterCircuit
+	case RejectEmergency:
+		retryAfter = g.cfg.RetryAfterEmergency
+	}
+
+	return ErrOverloaded{
+		Key:        key,
+		Level:      level,
+		Rejection:  rejection,
+		RetryAfter: time.Duration(retryAfter) * time.Second,
+	}
+}
+
+// check runs the circuit breaker and backpressure checks for a request of
+// tier to key and records the decision on span. probe reports that the request
+// was let through as a recovery probe. Rejections are recorded as enforced
+// or, in shadow mode, as would-be rejections. Checks that are not enforced
+// run against the shadow breaker, which stays out of the circuit group and
+// the metrics.
+func (g *Gate) check(ctx context.Context, key string, tier Criticality, stream, enforce bool, state *gateState, span DecisionSpan) (level Level, reason Reason, stats Stats, probe bool, err error) {
+	circuitBreaker := state.breaker
+	if !enforce {
+		circuitBreaker = state.shadowBreaker
+	}
+
+	// observe reports the breaker's state after recording an outcome on it
+	observe := func() {
+		if enforce {
+			g.circuits.Observe(key, circuitBreaker)
+			g.metrics.RecordCircuitBreakerState(key, circuitBreaker.State())
+		}
+	}
+
+	var allowed bool
+	if enforce {
+		allowed = g.circuits.Allow(key, circuitBreaker)
+	} else {
+		allowed = circuitBreaker.Allow()
+	}
+	if !allowed {
+		span.RecordCircuitBreakerState(circuitBreaker.State(), true)
+		g.logger.WarnContext(ctx, "circuit breaker open", g.keyName, key)
+		if enforce {
+			g.metrics.RecordCircuitBreakerState(key, circuitBreaker.State())
+		}
+
+		// Record rejected request
+		g.recordRejection(ctx, RequestLabels{
+			Method:      key,
+			Level:       Emergency,
+			Criticality: tier,
+			Result:      ResultRejected,
+		}, enforce)
+
+		return Emergency, reason, stats, false, g.reject(key, Emergency, RejectCircuitOpen)
+	}
+
+	span.RecordCircuitBreakerState(circuitBreaker.State(), false)
+
+	stats = state.tracker.Value()
+	defer func() { span.RecordDecision(stats, level, err != nil) }()
+
+	level, reason, from := state.level.Evaluate(stats, g.policy, g.exitPolicy, g.cfg.LevelMinDwell)
+	changed := level != from
+	if changed && g.cfg.OnLevelChange != nil {
+		g.cfg.OnLevelChange(key, from, level, stats)
+	}
+
+	// Streams are also held back by their own per-message latency
+	if stream {
+		streamStats := g.streamTracker(state).Value()
+		streamLevel, streamReason, streamFrom := state.streamLevel.Evaluate(streamStats, g.policy, g.exitPolicy, g.cfg.LevelMinDwell)
+		if streamLevel > level {
+			level, reason, stats, changed = streamLevel, streamReason, streamStats, streamLevel != streamFrom
+		}
+	}
+
+	// Lower tiers are rejected outright before the key reaches Critical. In
+	// brownout mode, where Critical admits the other tiers, they stay shed.
+	shedLevel := tier.ShedLevel()
+	if level >= shedLevel && (level < Critical || g.cfg.Brownout && shedLevel < Critical && level < Emergency) {
+		g.logger.WarnContext(ctx, "backpressure shed by criticality",
+			"level", level,
+			g.keyName, key,
+			"criticality", tier,
+			"reason", reason)
+		g.recordRejection(ctx, RequestLabels{
+			Method:      key,
+			Level:       level,
+			Criticality: tier,
+			Result:      ResultShed,
+		}, enforce)
+		return level, reason, stats, false, g.reject(key, level, RejectCriticality)
+	}
+
+	// In brownout mode, admit the surviving overloaded requests with
+	// Decision.Degrade set instead of rejecting them, until the key reaches
+	// Emergency
+	if g.cfg.Brownout && level >= Moderate && level < Emergency {
+		if changed {
+			g.logger.WarnContext(ctx, "backpressure brownout",
+				"level", level,
+				g.keyName, key,
+				"reason", reason,
+				"ema", stats.EMA,
+				"p95", stats.P95,
+				"p99", stats.P99)
+		}
+		return level, reason, stats, false, nil
+	}
+
+	// With a shed policy, reject a fraction of requests instead of all of
+	// them until Emergency. Critical requests are not shed.
+	if g.cfg.Shedding != nil && level >= Moderate && level < Emergency && tier != CriticalityCritical {
+		ratio := g.cfg.Shedding.RejectRatio(stats, g.cfg.Thresholds)
+		if chance(ratio) {
+			g.logger.WarnContext(ctx, "backpressure shed",
+				"level", level,
+				g.keyName, key,
+				"shed_ratio", ratio,
+				"reason", reason,
+				"ema", stats.EMA,
+				"p95", stats.P95,
+				"p99", stats.P99)
+			g.recordRejection(ctx, RequestLabels{
+				Method:      key,
+				Level:       level,
+				Criticality: tier,
+				Result:      ResultShed,
+			}, enforce)
+			return level, reason, stats, false, g.reject(key, level, RejectShed)
+		}
+
+		if changed {
+			g.logger.WarnContext(ctx, "backpressure detected",
+				"level", level,
+				g.keyName, key,
+				"shed_ratio", ratio,
+				"reason", reason,
+				"ema", stats.EMA,
+				"p95", stats.P95,
+				"p99", stats.P99)
+		}
+		return level, reason, stats, false, nil
+	}
+
+	// Let a small fraction through so the tracker can observe recovery
+	if level >= Critical && level >= shedLevel && chance(g.cfg.ProbeRatio) {
+		g.logger.DebugContext(ctx, "backpressure probe",
+			"level", level,
+			g.keyName, key)
+		return level, reason, stats, true, nil
+	}
+
+	switch {
+	case level == Emergency:
+		circuitBreaker.RecordFailure()
+		g.logger.ErrorContext(ctx, "backpressure emergency",
+			g.keyName, key,
+			"reason", reason,
+			"ema", stats.EMA,
+			"p95", stats.P95,
+			"p99", stats.P99)
+		observe()
+		g.recordRejection(ctx, RequestLabels{
+			Method:      key,
+			Level:       level,
+			Criticality: tier,
+			Result:      ResultRejected,
+		}, enforce)
+		return level, reason, stats, false, g.reject(key, level, RejectEmergency)
+
+	case level == Critical && level >= shedLevel:
+		circuitBreaker.RecordFailure()
+		g.logger.ErrorContext(ctx, "backpressure critical",
+			g.keyName, key,
+			"reason", reason,
+			"ema", stats.EMA,
+			"p95", stats.P95,
+			"p99", stats.P99)
+		observe()
+		g.recordRejection(ctx, RequestLabels{
+			Method:      key,
+			Level:       level,
+			Criticality: tier,
+			Result:      ResultRejected,
+		}, enforce)
+		return level, reason, stats, false, g.reject(key, level, RejectCritical)
+
+	case level >= Warning:
+		if changed {
+			g.logger.WarnContext(ctx, "backpressure detected",
+				"level", level,
+				g.keyName, key,
+				"reason", reason,
+				"ema", stats.EMA,
+				"p95", stats.P95,
+				"p99", stats.P99)
+		}
+
+	default:
+		if changed {
+			g.logger.InfoContext(ctx, "backpressure recovered", g.keyName, key)
+		}
+		circuitBreaker.RecordSuccess()
+		observe()
+	}
+
+	return level, reason, stats, false, nil
+}
+
+// Observe feeds a latency sample for the decision's key without completing
+// the request, e.g. the handler time of one message on a stream. Samples of
+// streams are tracked apart from request latency.
+func (d Decision) Observe(latency time.Duration) {
+	if d.stream {
+		d.gate.dispatcher.Emit(d.gate.streamTracker(d.state), latency)
+		return
+	}
+	d.gate.dispatcher.Emit(d.state.tracker, latency)
+}
+
+// Done completes an admitted request. latency is the time the request took
+// and err its outcome; a non-nil err is recorded as an error result.
+func (d Decision) Done(latency time.Duration, err error) {
+	g, state := d.gate, d.state
+
+	// A stream's duration says nothing about load; its messages were
+	// observed as they went
+	if !d.stream {
+		if d.acquired {
+			// A request whose context ended was cut short: a strong overload signal
+			if limit, changed := state.limiter.Release(latency, d.ctx.Err() != nil); changed && g.concurrencyMetrics != nil {
+				g.concurrencyMetrics.RecordConcurrencyLimit(d.key, limit, state.limiter.InFlight())
+			}
+		}
+		g.dispatcher.Emit(state.tracker, latency)
+	}
+	now := time.Now()
+	state.lastUpdate.Store(now.UnixNano())
+
+	if d.tenant != nil && !d.stream {
+		state.tenantLoads.add(d.tenant, latency, now)
+	}
+	d.releaseTenant()
+
+	// Record request completion
+	result := ResultSuccess
+	if d.Probe {
+		result = ResultProbe
+	}
+	if d.Degrade {
+		result = ResultDegraded
+	}
+	if err != nil {
+		result = ResultError
+	}
+	g.metrics.RecordRequest(d.ctx, RequestLabels{
+		Method:      d.key,
+		Level:       d.Level,
+		Criticality: d.Criticality,
+		Result:      result,
+	}, latency, false)
+}
+
+// Cancel releases an admitted request that will not run, e.g. because a
+// later check of the caller rejected it. Nothing is recorded for it. Call
+// either Done or Cancel, not both.
+func (d Decision) Cancel() {
+	if d.acquired {
+		d.state.limiter.Cancel()
+	}
+	d.releaseTenant()
+}
+
+// releaseTenant removes the request from its tenant's in-flight count.
+func (d Decision) releaseTenant() {
+	if d.tenant == nil {
+		return
+	}
+	d.state.tenantInFlight.Add(-1)
+	if d.tenant.inFlight.Add(-1) == 0 {
+		d.state.activeTenants.Add(-1)
+	}
+}
+
+// chance reports true with probability ratio.
+func chance(ratio float64) bool {
+	return ratio > 0 && rand.Float64() < ratio
+}
@@ -0,0 +1,580 @@
+package floodgate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testGateConfig() GateConfig {
+	cfg := DefaultGateConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = NoOpLogger{}
+	cfg.ProbeRatio = 0
+	return cfg
+}
+
+func TestGate_AdmitAndDone(t *testing.T) {
+	ctx := context.Background()
+	gate := NewGate(ctx, testGateConfig())
+
+	decision, err := gate.Admit(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("Expected request to be admitted, got %v", err)
+	}
+	if decision.Level != Normal {
+		t.Errorf("Expected normal level, got %v", decision.Level)
+	}
+	decision.Done(time.Millisecond, nil)
+
+	// Wait for the dispatcher to record the latency
+	time.Sleep(10 * time.Millisecond)
+
+	snapshot := gate.Snapshot()
+	if len(snapshot.Keys) != 1 || snapshot.Keys[0].Key != "jobs" || snapshot.Keys[0].LastUpdate.IsZero() {
+		t.Errorf("Unexpected snapshot: %+v", snapshot.Keys)
+	}
+}
+
+func TestGate_RejectsWithErrOverloaded(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Emergency, ReasonP99Emergency
+	})
+	gate := NewGate(ctx, cfg)
+
+	_, err := gate.Admit(ctx, "jobs")
+
+	var overloaded ErrOverloaded
+	if !errors.As(err, &overloaded) {
+		t.Fatalf("Expected ErrOverloaded, got %v", err)
+	}
+	if overloaded.Key != "jobs" || overloaded.Level != Emergency || overloaded.Rejection != RejectEmergency {
+		t.Errorf("Unexpected rejection: %+v", overloaded)
+	}
+	if overloaded.RetryAfter != time.Duration(cfg.RetryAfterEmergency)*time.Second {
+		t.Errorf("Expected emergency retry-after, got %v", overloaded.RetryAfter)
+	}
+}
+
+func TestGate_ConcurrencyLimit(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.ConcurrencyLimiter = func() *Limiter {
+		return NewLimiter(AIMDLimit{}, 1, 1, 1)
+	}
+	gate := NewGate(ctx, cfg)
+
+	first, err := gate.Admit(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("Expected first request to be admitted, got %v", err)
+	}
+
+	var overloaded ErrOverloaded
+	if _, err := gate.Admit(ctx, "jobs"); !errors.As(err, &overloaded) || overloaded.Rejection != RejectLimited {
+		t.Fatalf("Expected concurrency limit rejection, got %v", err)
+	}
+
+	// Streams are not concurrency limited
+	stream, err := gate.AdmitStream(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("Expected stream to bypass the limiter, got %v", err)
+	}
+	stream.Done(time.Second, nil)
+
+	first.Done(time.Millisecond, nil)
+	if _, err := gate.Admit(ctx, "jobs"); err != nil {
+		t.Errorf("Expected request to be admitted after Done, got %v", err)
+	}
+}
+
+func TestGate_CancelReleasesLimiter(t *testing.T) {
+	ctx := WithTenant(context.Background(), "acme")
+	cfg := testGateConfig()
+	cfg.ConcurrencyLimiter = func() *Limiter {
+		return NewLimiter(AIMDLimit{}, 1, 1, 1)
+	}
+	gate := NewGate(ctx, cfg)
+
+	decision, err := gate.Admit(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("Expected first request to be admitted, got %v", err)
+	}
+	decision.Cancel()
+
+	if _, err := gate.Admit(ctx, "jobs"); err != nil {
+		t.Errorf("Expected request to be admitted after Cancel, got %v", err)
+	}
+	if inFlight := gate.state("jobs").tenantInFlight.Load(); inFlight != 1 {
+		t.Errorf("Expected 1 tenant request in flight, got %d", inFlight)
+	}
+}
+
+func TestGate_SheddingKeepsEmergencyHardReject(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.Shedding = ProportionalShedding{MaxRatio: 0.1}
+	cfg.CircuitBreakerMaxFailures = 1000
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Emergency, ReasonP99Emergency
+	})
+	gate := NewGate(ctx, cfg)
+
+	for range 100 {
+		_, err := gate.Admit(ctx, "jobs")
+		var overloaded ErrOverloaded
+		if !errors.As(err, &overloaded) || overloaded.Rejection != RejectEmergency {
+			t.Fatalf("Expected every request to be rejected at Emergency, got %v", err)
+		}
+	}
+
+	// Emergency rejections still count towards the circuit breaker
+	breaker := gate.state("jobs").breaker
+	breaker.mu.RLock()
+	failures := breaker.failureCount
+	breaker.mu.RUnlock()
+	if failures != 100 {
+		t.Errorf("Expected 100 breaker failures, got %d", failures)
+	}
+}
+
+func TestGate_StreamsDoNotDiluteRequestLatency(t *testing.T) {
+	ctx := context.Background()
+	gate := NewGate(ctx, testGateConfig())
+
+	// Slow requests put the key at Emergency
+	for range 20 {
+		decision, err := gate.Admit(ctx, "jobs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		decision.Done(20*time.Second, nil)
+	}
+
+	// A long stream of quick messages must not pull request latency down
+	stream, err := gate.AdmitStream(ctx, "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 1000 {
+		stream.Observe(time.Microsecond)
+	}
+	stream.Done(time.Hour, nil)
+
+	time.Sleep(10 * time.Millisecond)
+
+	var overloaded ErrOverloaded
+	if _, err := gate.Admit(ctx, "jobs"); !errors.As(err, &overloaded) || overloaded.Level != Emergency {
+		t.Fatalf("Expected slow requests to keep the key at Emergency, got %v", err)
+	}
+
+	stream, err = gate.AdmitStream(ctx, "jobs")
+	if !errors.As(err, &overloaded) {
+		t.Fatalf("Expected new streams to be held back by request latency, got %v", err)
+	}
+
+	// A long, slow stream must not raise the request level of its key
+	stream, err = gate.AdmitStream(ctx, "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 20 {
+		stream.Observe(20 * time.Second)
+	}
+	stream.Done(time.Hour, nil)
+
+	time.Sleep(10 * time.Millisecond)
+
+	decision, err := gate.Admit(ctx, "chat")
+	if err != nil {
+		t.Fatalf("Expected requests to be admitted despite slow stream messages, got %v", err)
+	}
+	if decision.Level != Normal {
+		t.Errorf("Expected normal request level, got %v", decision.Level)
+	}
+	decision.Done(time.Millisecond, nil)
+
+	if _, err := gate.AdmitStream(ctx, "chat"); !errors.As(err, &overloaded) || overloaded.Level != Emergency {
+		t.Errorf("Expected new streams to be held back by slow messages, got %v", err)
+	}
+
+	var streams *DebugStream
+	for _, key := range gate.Snapshot().Keys {
+		if key.Key == "chat" {
+			streams = key.Stream
+		}
+	}
+	if streams == nil || streams.Level != Emergency || streams.Stats.Count == 0 {
+		t.Errorf("Expected stream state in the snapshot, got %+v", streams)
+	}
+}
+
+// basicMetrics implements MetricsCollector and none of its extensions.
+type basicMetrics struct{}
+
+func (basicMetrics) RecordRequest(context.Context, RequestLabels, time.Duration, bool) {}
+func (basicMetrics) RecordCircuitBreakerState(string, CircuitState)                    {}
+func (basicMetrics) RecordCacheSize(int)                                               {}
+func (basicMetrics) RecordDispatcherStats(uint64, uint64)                              {}
+
+// limitMetrics records concurrency limits.
+type limitMetrics struct {
+	NoOpMetrics
+	limits atomic.Int64
+}
+
+func (m *limitMetrics) RecordConcurrencyLimit(method string, limit, inFlight int) {
+	m.limits.Add(1)
+}
+
+func TestGate_ConcurrencyMetricsAreOptional(t *testing.T) {
+	ctx := context.Background()
+
+	for name, metrics := range map[string]MetricsCollector{
+		"basic":  basicMetrics{},
+		"limits": &limitMetrics{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := testGateConfig()
+			cfg.Metrics = metrics
+			cfg.ConcurrencyLimiter = func() *Limiter {
+				return NewLimiter(AIMDLimit{}, 1, 1, 10)
+			}
+			gate := NewGate(ctx, cfg)
+
+			decision, err := gate.Admit(ctx, "jobs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			decision.Done(time.Millisecond, nil)
+
+			if m, ok := metrics.(*limitMetrics); ok && m.limits.Load() != 1 {
+				t.Errorf("Expected the limit change to be recorded, got %d", m.limits.Load())
+			}
+		})
+	}
+}
+
+// evictionMetrics records evicted keys.
+type evictionMetrics struct {
+	NoOpMetrics
+	mu      sync.Mutex
+	evicted []string
+}
+
+func (m *evictionMetrics) RecordEviction(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evicted = append(m.evicted, method)
+}
+
+func TestGate_RecordsEvictions(t *testing.T) {
+	ctx := context.Background()
+	metrics := &evictionMetrics{}
+	cfg := testGateConfig()
+	cfg.CacheSize = 1
+	cfg.Metrics = metrics
+	gate := NewGate(ctx, cfg)
+
+	for _, key := range []string{"jobs", "users"} {
+		decision, err := gate.Admit(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decision.Done(time.Millisecond, nil)
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if len(metrics.evicted) != 1 || metrics.evicted[0] != "jobs" {
+		t.Errorf("Expected jobs to be evicted, got %v", metrics.evicted)
+	}
+}
+
+func TestGate_DeadlineTooShort(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.DeadlinePercentile = 0.95
+	cfg.DeadlineMargin = 10 * time.Millisecond
+	gate := NewGate(ctx, cfg)
+
+	for range 20 {
+		decision, err := gate.Admit(ctx, "jobs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		decision.Done(100*time.Millisecond, nil)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	var overloaded ErrOverloaded
+	if _, err := gate.Admit(short, "jobs"); !errors.As(err, &overloaded) || overloaded.Rejection != RejectDeadline {
+		t.Fatalf("Expected deadline rejection, got %v", err)
+	}
+	if overloaded.RetryAfter != 0 {
+		t.Errorf("Expected no retry-after for deadline rejection, got %v", overloaded.RetryAfter)
+	}
+
+	long, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := gate.Admit(long, "jobs"); err != nil {
+		t.Errorf("Expected request with enough time to be admitted, got %v", err)
+	}
+
+	if _, err := gate.Admit(ctx, "jobs"); err != nil {
+		t.Errorf("Expected request without deadline to be admitted, got %v", err)
+	}
+}
+
+func TestGate_CriticalityTiers(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	var level atomic.Int64
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Level(level.Load()), ReasonWithinThresholds
+	})
+	gate := NewGate(ctx, cfg)
+
+	tests := []struct {
+		level    Level
+		tier     Criticality
+		rejected bool
+	}{
+		{Warning, CriticalityBackground, true},
+		{Warning, CriticalitySheddable, false},
+		{Moderate, CriticalitySheddable, true},
+		{Moderate, CriticalityDefault, false},
+		{Critical, CriticalityDefault, true},
+		{Critical, CriticalityCritical, false},
+		{Emergency, CriticalityCritical, true},
+	}
+
+	for _, tt := range tests {
+		level.Store(int64(tt.level))
+		decision, err := gate.Admit(WithCriticality(ctx, tt.tier), "jobs")
+		if rejected := err != nil; rejected != tt.rejected {
+			t.Errorf("%v request at %v: rejected = %v, want %v", tt.tier, tt.level, rejected, tt.rejected)
+			continue
+		}
+		if err == nil {
+			if decision.Criticality != tt.tier {
+				t.Errorf("Expected decision criticality %v, got %v", tt.tier, decision.Criticality)
+			}
+			decision.Done(time.Millisecond, nil)
+		}
+	}
+}
+
+func TestParseCriticality(t *testing.T) {
+	for _, c := range []Criticality{CriticalityDefault, CriticalityCritical, CriticalitySheddable, CriticalityBackground} {
+		if parsed, ok := ParseCriticality(c.String()); !ok || parsed != c {
+			t.Errorf("ParseCriticality(%q) = %v, %v", c.String(), parsed, ok)
+		}
+	}
+	if _, ok := ParseCriticality("urgent"); ok {
+		t.Error("Expected unknown tier to fail to parse")
+	}
+}
+
+func TestGate_TenantFairness(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Moderate, ReasonP95Moderate
+	})
+	gate := NewGate(ctx, cfg)
+
+	noisy := WithTenant(ctx, "noisy")
+	quiet := WithTenant(ctx, "quiet")
+
+	var held []Decision
+	for range 3 {
+		decision, err := gate.Admit(noisy, "search")
+		if err != nil {
+			t.Fatalf("Expected lone tenant to be admitted, got %v", err)
+		}
+		held = append(held, decision)
+	}
+	decision, err := gate.Admit(quiet, "search")
+	if err != nil {
+		t.Fatalf("Expected quiet tenant to be admitted, got %v", err)
+	}
+	held = append(held, decision)
+
+	var overloaded ErrOverloaded
+	if _, err := gate.Admit(noisy, "search"); !errors.As(err, &overloaded) || overloaded.Rejection != RejectTenant {
+		t.Errorf("Expected noisy tenant to be shed, got %v", err)
+	}
+	if _, err := gate.Admit(quiet, "search"); err != nil {
+		t.Errorf("Expected quiet tenant to be admitted, got %v", err)
+	}
+
+	// Once the noisy tenant's requests finish it is admitted again, as long
+	// as its recent load is no larger than the quiet tenant's
+	for _, decision := range held {
+		latency := time.Millisecond
+		if decision.Tenant == "quiet" {
+			latency = 3 * time.Millisecond
+		}
+		decision.Done(latency, nil)
+	}
+	if _, err := gate.Admit(noisy, "search"); err != nil {
+		t.Errorf("Expected noisy tenant to be admitted after its requests finished, got %v", err)
+	}
+}
+
+func TestGate_TenantFairnessShortRequests(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	var level atomic.Int64
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Level(level.Load()), ReasonWithinThresholds
+	})
+	gate := NewGate(ctx, cfg)
+
+	chatty := WithTenant(ctx, "chatty")
+	quiet := WithTenant(ctx, "quiet")
+
+	// The chatty tenant never has more than one request in flight, but
+	// sends far more of them
+	for range 100 {
+		decision, err := gate.Admit(chatty, "search")
+		if err != nil {
+			t.Fatal(err)
+		}
+		decision.Done(time.Millisecond, nil)
+	}
+	for range 5 {
+		decision, err := gate.Admit(quiet, "search")
+		if err != nil {
+			t.Fatal(err)
+		}
+		decision.Done(time.Millisecond, nil)
+	}
+
+	level.Store(int64(Moderate))
+	var overloaded ErrOverloaded
+	if _, err := gate.Admit(chatty, "search"); !errors.As(err, &overloaded) || overloaded.Rejection != RejectTenant {
+		t.Errorf("Expected chatty tenant to be shed, got %v", err)
+	}
+	if _, err := gate.Admit(quiet, "search"); err != nil {
+		t.Errorf("Expected quiet tenant to be admitted, got %v", err)
+	}
+}
+
+func TestGate_Brownout(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.Brownout = true
+	var level atomic.Int64
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Level(level.Load()), ReasonWithinThresholds
+	})
+	gate := NewGate(ctx, cfg)
+
+	level.Store(int64(Critical))
+	decision, err := gate.Admit(ctx, "feed")
+	if err != nil {
+		t.Fatalf("Expected critical request to be admitted in brownout mode, got %v", err)
+	}
+	if !decision.Degrade {
+		t.Error("Expected degrade flag at Critical")
+	}
+	decision.Done(time.Millisecond, nil)
+
+	// Lower tiers are shed rather than browned out
+	background := WithCriticality(ctx, CriticalityBackground)
+	for _, l := range []Level{Moderate, Critical} {
+		level.Store(int64(l))
+		var overloaded ErrOverloaded
+		if _, err := gate.Admit(background, "feed"); !errors.As(err, &overloaded) || overloaded.Rejection != RejectCriticality {
+			t.Errorf("Expected background request to be shed at %v in brownout mode, got %v", l, err)
+		}
+	}
+
+	level.Store(int64(Emergency))
+	if _, err := gate.Admit(ctx, "feed"); err == nil {
+		t.Error("Expected emergency request to be rejected in brownout mode")
+	}
+}
+
+// resultMetrics records the result of every request.
+type resultMetrics struct {
+	NoOpMetrics
+	mu      sync.Mutex
+	results []string
+}
+
+func (m *resultMetrics) RecordRequest(ctx context.Context, labels RequestLabels, latency time.Duration, rejected bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results = append(m.results, labels.Result)
+}
+
+func TestGate_Shadow(t *testing.T) {
+	ctx := context.Background()
+	metrics := &resultMetrics{}
+	cfg := testGateConfig()
+	cfg.Metrics = metrics
+	cfg.Shadow = true
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Emergency, ReasonP99Emergency
+	})
+	gate := NewGate(ctx, cfg)
+
+	decision, err := gate.Admit(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("Expected shadow mode to let the request through, got %v", err)
+	}
+	if !decision.Shadowed || decision.Level != Emergency {
+		t.Errorf("Expected shadowed emergency decision, got %+v", decision)
+	}
+	decision.Done(time.Millisecond, nil)
+
+	if want := []string{ResultWouldReject, ResultSuccess}; !slices.Equal(metrics.results, want) {
+		t.Errorf("Expected results %v, got %v", want, metrics.results)
+	}
+
+	// Full rollout enforces every rejection
+	cfg.ShadowEnforceRatio = 1
+	gate = NewGate(ctx, cfg)
+	if _, err := gate.Admit(ctx, "jobs"); err == nil {
+		t.Error("Expected rejection with ShadowEnforceRatio 1")
+	}
+}
+
+func TestGate_ShadowNeverOpensBreaker(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.Shadow = true
+	cfg.CircuitBreakerMaxFailures = 1
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Emergency, ReasonP99Emergency
+	})
+	gate := NewGate(ctx, cfg)
+
+	if _, err := gate.Admit(ctx, "jobs"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond) // breakers cannot open right after creation
+	for range 3 {
+		if _, err := gate.Admit(ctx, "jobs"); err != nil {
+			t.Fatalf("Expected shadow mode to let the request through, got %v", err)
+		}
+	}
+
+	state := gate.state("jobs")
+	if got := state.breaker.State(); got != StateClosed {
+		t.Errorf("Expected the real breaker to stay closed, got %v", got)
+	}
+	if got := state.shadowBreaker.State(); got != StateOpen {
+		t.Errorf("Expected the shadow breaker to open, got %v", got)
+	}
+}
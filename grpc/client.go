@@ -0,0 +1,348 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mushtruk/floodgate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	md "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ClientConfig holds configuration for the backpressure client interceptors.
+type ClientConfig struct {
+	// ThrottleK is the adaptive throttling multiplier: the client starts
+	// rejecting calls locally once requests exceed ThrottleK times the calls
+	// the target accepted. Lower values throttle more aggressively.
+	ThrottleK float64
+
+	// ThrottleWindow is how long requests and accepts are remembered.
+	ThrottleWindow time.Duration
+
+	// Circuit breaker configuration, per target. Unavailable,
+	// ResourceExhausted and DeadlineExceeded responses count as failures.
+	CircuitBreakerMaxFailures      int
+	CircuitBreakerTimeout          time.Duration
+	CircuitBreakerSuccessThreshold int
+
+	// MaxRetryAfter caps how long calls to a method of a target are refused
+	// after it rejects a call with a retry-after trailer. Zero ignores the
+	// trailer.
+	MaxRetryAfter time.Duration
+
+	// Logger for backpressure events. If nil, uses DefaultLogger.
+	Logger floodgate.Logger
+
+	// Metrics collector for observability. If nil, uses NoOpMetrics (disabled).
+	Metrics floodgate.MetricsCollector
+}
+
+// DefaultClientConfig returns sensible default configuration.
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		ThrottleK:      floodgate.DefaultThrottleK,
+		ThrottleWindow: 2 * time.Minute,
+
+		CircuitBreakerMaxFailures:      5,
+		CircuitBreakerTimeout:          30 * time.Second,
+		CircuitBreakerSuccessThreshold: 3,
+
+		MaxRetryAfter: 5 * time.Minute,
+
+		Logger:  floodgate.NewDefaultLogger(),
+		Metrics: &floodgate.NoOpMetrics{},
+	}
+}
+
+// client adapts per-target throttles and circuit breakers to the unary and
+// stream client interceptors.
+type client struct {
+	cfg     ClientConfig
+	logger  floodgate.Logger
+	metrics floodgate.MetricsCollector
+
+	mu      sync.Mutex
+	targets map[string]*targetState
+}
+
+// targetState holds the throttle, circuit breaker and retry-after deadlines of
+// a target.
+type targetState struct {
+	throttle *floodgate.AdaptiveThrottle
+	breaker  *floodgate.CircuitBreaker
+
+	// retryUntil is when the retry-after of each method passes, in Unix
+	// nanoseconds. Servers reject per method, so one method's retry-after
+	// does not hold back the others.
+	mu         sync.Mutex
+	retryUntil map[string]int64
+}
+
+// retrying reports whether calls to method are refused until a retry-after
+// passes.
+func (s *targetState) retrying(method string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.retryUntil[method]
+	if !ok {
+		return false
+	}
+	if time.Now().UnixNano() < until {
+		return true
+	}
+	delete(s.retryUntil, method)
+	return false
+}
+
+// retryAfter refuses calls to method for wait.
+func (s *targetState) retryAfter(method string, wait time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryUntil[method] = time.Now().Add(wait).UnixNano()
+}
+
+// UnaryClientInterceptor creates a gRPC unary client interceptor with adaptive throttling.
+func UnaryClientInterceptor(cfg ClientConfig) grpc.UnaryClientInterceptor {
+	return newClient(cfg).unary
+}
+
+// StreamClientInterceptor creates a gRPC stream client interceptor with adaptive throttling.
+// Admission is checked once when the stream opens and the outcome is recorded when it ends.
+func StreamClientInterceptor(cfg ClientConfig) grpc.StreamClientInterceptor {
+	return newClient(cfg).stream
+}
+
+// ClientInterceptors creates unary and stream client interceptors that share
+// the same per-target throttles and circuit breakers.
+//
+// Calls rejected locally fail with codes.Unavailable without being sent.
+//
+// Example:
+//
+//	unary, stream := bpgrpc.ClientInterceptors(bpgrpc.DefaultClientConfig())
+//	conn, err := grpc.NewClient(target,
+//	    grpc.WithUnaryInterceptor(unary),
+//	    grpc.WithStreamInterceptor(stream),
+//	)
+func ClientInterceptors(cfg ClientConfig) (grpc.UnaryClientInterceptor, grpc.StreamClientInterceptor) {
+	c := newClient(cfg)
+	return c.unary, c.stream
+}
+
+func newClient(cfg ClientConfig) *client {
+	// Use provided logger or default
+	logger := cfg.Logger
+	if logger == nil {
+		logger = floodgate.NewDefaultLogger()
+	}
+
+	// Use provided metrics or no-op
+	metrics := cfg.Metrics
+	if metrics == nil {
+		metrics = &floodgate.NoOpMetrics{}
+	}
+
+	return &client{
+		cfg:     cfg,
+		logger:  logger,
+		metrics: metrics,
+		targets: make(map[string]*targetState),
+	}
+}
+
+// target returns the state for target, creating it on first use. Targets are
+// bounded by the connections the application opens, so they are not evicted.
+func (c *client) target(target string) *targetState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.targets[target]
+	if !ok {
+		state = &targetState{
+			throttle: floodgate.NewAdaptiveThrottle(c.cfg.ThrottleK, c.cfg.ThrottleWindow),
+			breaker: floodgate.NewCircuitBreaker(
+				c.cfg.CircuitBreakerMaxFailures,
+				c.cfg.CircuitBreakerTimeout,
+				c.cfg.CircuitBreakerSuccessThreshold,
+			),
+			retryUntil: make(map[string]int64),
+		}
+		c.targets[target] = state
+	}
+	return state
+}
+
+func (c *client) unary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	target := cc.Target()
+	state := c.target(target)
+
+	if err := c.admit(ctx, target, method, state); err != nil {
+		return err
+	}
+
+	var trailer md.MD
+	start := time.Now()
+	// Copy opts so the trailer option never lands in the caller's backing array
+	err := invoker(ctx, method, req, reply, cc, append(opts[:len(opts):len(opts)], grpc.Trailer(&trailer))...)
+	c.done(ctx, target, method, state, time.Since(start), err, trailer)
+
+	return err
+}
+
+func (c *client) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	target := cc.Target()
+	state := c.target(target)
+
+	if err := c.admit(ctx, target, method, state); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		c.done(ctx, target, method, state, time.Since(start), err, nil)
+		return nil, err
+	}
+
+	stream := &throttledStream{
+		ClientStream:  cs,
+		serverStreams: desc.ServerStreams,
+		done: func(err error) {
+			c.done(ctx, target, method, state, time.Since(start), err, cs.Trailer())
+		},
+	}
+
+	// Streams the caller abandons without draining end with their context
+	stream.stop = context.AfterFunc(ctx, func() {
+		stream.finish(status.FromContextError(ctx.Err()).Err())
+	})
+
+	return stream, nil
+}
+
+// admit runs the retry-after, circuit breaker and throttle checks for a call.
+func (c *client) admit(ctx context.Context, target, method string, state *targetState) error {
+	if state.retrying(method) {
+		return c.reject(ctx, target, method, floodgate.Normal, floodgate.RejectRetryAfter)
+	}
+
+	if !state.breaker.Allow() {
+		c.metrics.RecordCircuitBreakerState(target, state.breaker.State())
+		return c.reject(ctx, target, method, floodgate.Emergency, floodgate.RejectCircuitOpen)
+	}
+
+	if !state.throttle.Allow() {
+		return c.reject(ctx, target, method, floodgate.Normal, floodgate.RejectThrottled)
+	}
+
+	return nil
+}
+
+// reject logs and records a call rejected locally.
+func (c *client) reject(ctx context.Context, target, method string, level floodgate.Level, rejection floodgate.Rejection) error {
+	c.logger.WarnContext(ctx, "outbound call rejected",
+		"target", target,
+		"method", method,
+		"rejection", rejection)
+	c.metrics.RecordRequest(ctx, floodgate.RequestLabels{
+		Method: method,
+		Level:  level,
+		Result: floodgate.ResultRejected,
+	}, 0, true)
+
+	return status.Errorf(codes.Unavailable, "client backpressure - %s", rejection)
+}
+
+// done records the outcome of a call that was sent to target.
+func (c *client) done(ctx context.Context, target, method string, state *targetState, latency time.Duration, err error, trailer md.MD) {
+	code := status.Code(err)
+	overloaded := code == codes.Unavailable || code == codes.ResourceExhausted
+
+	// Anything the target did not refuse for overload counts as accepted
+	if !overloaded {
+		state.throttle.Accepted()
+	}
+
+	if overloaded || code == codes.DeadlineExceeded {
+		state.breaker.RecordFailure()
+	} else {
+		state.breaker.RecordSuccess()
+	}
+
+	if overloaded {
+		c.honorRetryAfter(ctx, target, method, state, trailer)
+	}
+
+	result := floodgate.ResultSuccess
+	if err != nil {
+		result = floodgate.ResultError
+	}
+	c.metrics.RecordRequest(ctx, floodgate.RequestLabels{
+		Method: method,
+		Level:  floodgate.Normal,
+		Result: result,
+	}, latency, false)
+}
+
+// honorRetryAfter refuses calls to method on target until the retry-after
+// trailer set by the server interceptor has passed.
+func (c *client) honorRetryAfter(ctx context.Context, target, method string, state *targetState, trailer md.MD) {
+	values := trailer.Get("retry-after")
+	if len(values) == 0 || c.cfg.MaxRetryAfter <= 0 {
+		return
+	}
+	seconds, err := strconv.Atoi(values[0])
+	if err != nil || seconds <= 0 {
+		return
+	}
+	wait := min(time.Duration(seconds)*time.Second, c.cfg.MaxRetryAfter)
+
+	state.retryAfter(method, wait)
+	c.logger.InfoContext(ctx, "upstream requested retry-after",
+		"target", target,
+		"method", method,
+		"retry_after", wait)
+}
+
+// throttledStream wraps a grpc.ClientStream and records the outcome of the
+// stream once it ends: when RecvMsg reports the end of the stream, or when
+// its context is done if the caller stops reading first.
+type throttledStream struct {
+	grpc.ClientStream
+	serverStreams bool
+
+	once sync.Once
+	done func(err error)
+	stop func() bool
+}
+
+func (s *throttledStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == io.EOF:
+		s.end(nil)
+	case err != nil:
+		s.end(err)
+	case !s.serverStreams:
+		// Streams with a single response end after the first message
+		s.end(nil)
+	}
+	return err
+}
+
+// end records the outcome of a stream the caller read to its end.
+func (s *throttledStream) end(err error) {
+	s.stop()
+	s.finish(err)
+}
+
+// finish records the outcome of the stream the first time it is called.
+func (s *throttledStream) finish(err error) {
+	s.once.Do(func() { s.done(err) })
+}
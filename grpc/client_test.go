@@ -0,0 +1,180 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	md "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func testClientConn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///backend", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// overloadedInvoker rejects every call and sets trailer on it.
+func overloadedInvoker(calls *int, trailer md.MD) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		*calls++
+		for _, opt := range opts {
+			if t, ok := opt.(grpc.TrailerCallOption); ok {
+				*t.TrailerAddr = trailer
+			}
+		}
+		return status.Error(codes.ResourceExhausted, "service overloaded")
+	}
+}
+
+func TestClientInterceptor_HonorsRetryAfter(t *testing.T) {
+	ctx := context.Background()
+	conn := testClientConn(t)
+	interceptor := UnaryClientInterceptor(DefaultClientConfig())
+
+	// Accepted calls keep adaptive throttling out of the way
+	ok := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	for range 10 {
+		if err := interceptor(ctx, "/test.Service/Other", nil, nil, conn, ok); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	calls := 0
+	invoker := overloadedInvoker(&calls, md.Pairs("retry-after", "30"))
+
+	if err := interceptor(ctx, "/test.Service/Method", nil, nil, conn, invoker); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected upstream rejection, got %v", err)
+	}
+
+	err := interceptor(ctx, "/test.Service/Method", nil, nil, conn, invoker)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected local Unavailable, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", calls)
+	}
+
+	// The retry-after only holds back the method that was rejected
+	if err := interceptor(ctx, "/test.Service/Other", nil, nil, conn, invoker); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected other method to reach upstream, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", calls)
+	}
+}
+
+func TestClientInterceptor_AdaptiveThrottle(t *testing.T) {
+	ctx := context.Background()
+	conn := testClientConn(t)
+	cfg := DefaultClientConfig()
+	cfg.CircuitBreakerMaxFailures = 1000 // isolate throttling from the breaker
+	interceptor := UnaryClientInterceptor(cfg)
+
+	calls := 0
+	invoker := overloadedInvoker(&calls, nil)
+
+	const attempts = 200
+	for range attempts {
+		_ = interceptor(ctx, "/test.Service/Method", nil, nil, conn, invoker)
+	}
+
+	if calls >= attempts/2 {
+		t.Errorf("Expected most calls to be throttled locally, %d of %d were sent", calls, attempts)
+	}
+}
+
+// fakeClientStream ends after msgs messages.
+type fakeClientStream struct {
+	grpc.ClientStream
+	msgs int
+}
+
+func (s *fakeClientStream) RecvMsg(m any) error {
+	if s.msgs == 0 {
+		return io.EOF
+	}
+	s.msgs--
+	return nil
+}
+
+func (s *fakeClientStream) Trailer() md.MD { return nil }
+
+func TestClientInterceptor_DoesNotWriteIntoCallerOptions(t *testing.T) {
+	ctx := context.Background()
+	conn := testClientConn(t)
+	interceptor := UnaryClientInterceptor(DefaultClientConfig())
+
+	// Spare capacity after the caller's options must not be written to
+	backing := []grpc.CallOption{grpc.WaitForReady(true), grpc.EmptyCallOption{}}
+	opts := backing[:1]
+
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	if err := interceptor(ctx, "/test.Service/Method", nil, nil, conn, invoker, opts...); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := backing[1].(grpc.EmptyCallOption); !ok {
+		t.Errorf("Expected the caller's backing array to be untouched, got %T", backing[1])
+	}
+}
+
+func TestStreamClientInterceptor_RecordsAbandonedStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := testClientConn(t)
+	c := newClient(DefaultClientConfig())
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{msgs: 3}, nil
+	}
+
+	cs, err := c.stream(ctx, &grpc.StreamDesc{ServerStreams: true}, conn, "/test.Service/Watch", streamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.RecvMsg(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The caller stops reading and cancels the stream
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	if p := c.target(conn.Target()).throttle.RejectProbability(); p != 0 {
+		t.Errorf("Expected the abandoned stream to be recorded as accepted, got %v", p)
+	}
+}
+
+func TestStreamClientInterceptor_RecordsAccept(t *testing.T) {
+	ctx := context.Background()
+	conn := testClientConn(t)
+	c := newClient(DefaultClientConfig())
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{msgs: 3}, nil
+	}
+
+	cs, err := c.stream(ctx, &grpc.StreamDesc{ServerStreams: true}, conn, "/test.Service/Watch", streamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cs.RecvMsg(nil) == nil {
+	}
+
+	// One request, one accept
+	if p := c.target(conn.Target()).throttle.RejectProbability(); p != 0 {
+		t.Errorf("Expected accepted stream not to throttle, got %v", p)
+	}
+}
@@ -5,9 +5,9 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/mushtruk/floodgate"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -21,11 +21,33 @@ type Config struct {
 	CacheTTL             time.Duration
 	DispatcherBufferSize int
 	Thresholds           floodgate.Thresholds
-	SkipMethods          []string
 	EnableMetrics        bool
 	MetricsInterval      time.Duration
 
-	// Circuit breaker configuration
+	// LevelPolicy decides the backpressure level from a method's stats.
+	// If nil, uses ThresholdPolicy with Thresholds.
+	LevelPolicy floodgate.LevelPolicy
+
+	// ExitThresholds are the thresholds stats must fall below before a method's
+	// level de-escalates. Keeping them below Thresholds stops a method hovering
+	// around a threshold from flapping. If zero, uses Thresholds scaled by
+	// DefaultExitRatio. Ignored when LevelPolicy is set.
+	ExitThresholds floodgate.Thresholds
+
+	// Resources, if set, combines the process-wide resource level with every
+	// method's latency level; the more severe one wins. One monitor can be
+	// shared by several gates.
+	Resources *floodgate.ResourceMonitor
+
+	// LevelMinDwell is the minimum time a method stays at a level before it
+	// de-escalates. Zero de-escalates as soon as stats allow.
+	LevelMinDwell time.Duration
+
+	// Circuit breaker configuration. CircuitBreakerMode selects per-method,
+	// global or hybrid breakers; in hybrid mode every method is rejected while
+	// CircuitBreakerHybridThreshold per-method breakers are open.
+	CircuitBreakerMode             floodgate.CircuitMode
+	CircuitBreakerHybridThreshold  int
 	CircuitBreakerMaxFailures      int
 	CircuitBreakerTimeout          time.Duration
 	CircuitBreakerSuccessThreshold int
@@ -35,7 +57,88 @@ type Config struct {
 	TrackerWindowSize int
 	TrackerSampleSize int
 
-	// Retry-after headers (seconds)
+	// TrackerDecayHalfLife makes stats decay once no samples arrive, so a
+	// method that is being rejected recovers without waiting for CacheTTL.
+	// Zero disables decay.
+	TrackerDecayHalfLife time.Duration
+
+	// TrackerTimeWindow makes percentiles and trend describe the last window
+	// of traffic rather than the last TrackerSampleSize requests. Zero uses a
+	// sample-count window.
+	TrackerTimeWindow time.Duration
+
+	// TrackerQuantiles are quantiles tracked per method in addition to P50, P95
+	// and P99, e.g. 0.9 and 0.999. They can be used in Thresholds.Quantiles
+	// and are reported through Metrics and the Tracer.
+	TrackerQuantiles []float64
+
+	// TrackerQuantileEstimator creates the percentile estimator for each method,
+	// e.g. a DDSketch, in place of the exact TrackerSampleSize sample buffer.
+	// If nil, percentiles are exact.
+	TrackerQuantileEstimator func() floodgate.QuantileEstimator
+
+	// ProbeRatio is the fraction of requests admitted at Critical and Emergency
+	// levels so the tracker keeps seeing fresh latency. Zero disables probing.
+	ProbeRatio float64
+
+	// Shedding rejects a fraction of requests at Moderate and Critical,
+	// instead of rejecting all of them at Critical. Shed requests do not trip
+	// the circuit breaker. Emergency still rejects every request and counts
+	// towards the breaker. If nil, rejection is all-or-nothing.
+	Shedding floodgate.ShedPolicy
+
+	// DeadlinePercentile enables deadline-aware admission: a request whose
+	// context deadline leaves less time than this percentile of its method's
+	// latency plus DeadlineMargin is rejected with RejectDeadline instead of
+	// running only to time out. See Stats.Percentile for the supported values.
+	// Zero disables the check.
+	DeadlinePercentile float64
+
+	// DeadlineMargin is added to the latency estimate, e.g. to leave time
+	// for the response to reach the client.
+	DeadlineMargin time.Duration
+
+	// TenantCacheSize bounds the per-tenant state kept for fairness. Requests
+	// carry a tenant through WithTenant; once a method reaches Moderate, tenants
+	// holding more than their fair share of the method's in-flight requests, or
+	// of its recent load (the latency of requests completed over the last
+	// ten seconds or so), are rejected with RejectTenant before other tenants
+	// are affected. Streams count toward in-flight requests only.
+	// If zero, uses CacheSize.
+	TenantCacheSize int
+
+	// Brownout admits requests at Moderate and Critical with Decision.Degrade
+	// set instead of rejecting them, so handlers can degrade gracefully.
+	// Requests are still rejected at Emergency and while the circuit is open.
+	// Tiers shed below Critical are still shed from their Criticality.ShedLevel.
+	// Handlers read the decision with FromContext.
+	Brownout bool
+
+	// Shadow runs every check but only enforces ShadowEnforceRatio of the
+	// rejections. Requests that would have been rejected are logged, recorded
+	// with ResultWouldReject and let through. Levels and hooks keep working
+	// as usual, so they can be observed before rejection is switched on.
+	// Rejections that are not enforced count towards a separate shadow
+	// breaker per method, so they never open the real circuit breaker.
+	Shadow bool
+
+	// ShadowEnforceRatio is the fraction of rejections enforced in shadow
+	// mode, for a gradual rollout from 0 (log only) to 1 (enforce all).
+	ShadowEnforceRatio float64
+
+	// ConcurrencyLimiter creates the adaptive concurrency limiter for each method.
+	// Requests over the limit are rejected like critical backpressure. Streams
+	// are not limited.
+	// If nil, concurrency is not limited.
+	//
+	// Example:
+	//
+	//	cfg.ConcurrencyLimiter = func() *floodgate.Limiter {
+	//	    return floodgate.NewLimiter(floodgate.NewGradient2Limit(), 20, 1, 1000)
+	//	}
+	ConcurrencyLimiter func() *floodgate.Limiter
+
+	// Retry-after hints (seconds)
 	RetryAfterEmergency int
 	RetryAfterCritical  int
 	RetryAfterCircuit   int
@@ -45,6 +148,40 @@ type Config struct {
 
 	// Metrics collector for observability. If nil, uses NoOpMetrics (disabled).
 	Metrics floodgate.MetricsCollector
+
+	// Tracer records every admission decision as a span. If nil, uses NoOpTracer (disabled).
+	Tracer floodgate.Tracer
+
+	// OnLevelChange is called once per level transition of a method, with the
+	// stats that caused it. It runs on the request path, so it should return
+	// quickly. If nil, level changes are only logged.
+	OnLevelChange func(method string, from, to floodgate.Level, stats floodgate.Stats)
+
+	// OnCircuitStateChange is called once per state transition of a method's
+	// circuit breaker. In CircuitGlobal mode method is empty.
+	OnCircuitStateChange func(method string, from, to floodgate.CircuitState)
+
+	// SkipMethods lists method prefixes that bypass backpressure.
+	SkipMethods []string
+
+	// CriticalityMetadataKey names the incoming metadata key carrying the
+	// request tier, e.g. "x-criticality: background". Values are parsed with
+	// floodgate.ParseCriticality. Clients can claim any tier, so only set it
+	// for trusted callers. If empty, tiers only come from
+	// floodgate.WithCriticality in earlier interceptors.
+	CriticalityMetadataKey string
+
+	// TenantMetadataKey names the incoming metadata key identifying the
+	// tenant, for per-tenant fairness. Ignored when TenantFunc is set.
+	TenantMetadataKey string
+
+	// TenantFunc extracts the tenant from a request context, e.g. from an
+	// authenticated principal. If both TenantFunc and TenantMetadataKey are
+	// empty, tenants only come from floodgate.WithTenant in earlier interceptors.
+	TenantFunc func(ctx context.Context) string
+
+	// Debug, if set, exposes the live state of every tracked method under "grpc".
+	Debug *floodgate.DebugHandler
 }
 
 // DefaultConfig returns sensible default configuration.
@@ -60,7 +197,11 @@ func DefaultConfig() Config {
 		},
 		EnableMetrics:   true,
 		MetricsInterval: 1 * time.Minute,
+		LevelMinDwell:   2 * time.Second,
+		TenantCacheSize: 4096,
 
+		CircuitBreakerMode:             floodgate.CircuitPerKey,
+		CircuitBreakerHybridThreshold:  3,
 		CircuitBreakerMaxFailures:      3,
 		CircuitBreakerTimeout:          30 * time.Second,
 		CircuitBreakerSuccessThreshold: 5,
@@ -69,6 +210,9 @@ func DefaultConfig() Config {
 		TrackerWindowSize: 50,
 		TrackerSampleSize: 200,
 
+		TrackerDecayHalfLife: 10 * time.Second,
+		ProbeRatio:           0.01,
+
 		RetryAfterEmergency: 10,
 		RetryAfterCritical:  5,
 		RetryAfterCircuit:   30,
@@ -78,176 +222,255 @@ func DefaultConfig() Config {
 	}
 }
 
+// gateConfig returns the admission settings of cfg.
+func (cfg Config) gateConfig() floodgate.GateConfig {
+	return floodgate.GateConfig{
+		KeyName: "method",
+
+		CacheSize:                      cfg.CacheSize,
+		CacheTTL:                       cfg.CacheTTL,
+		DispatcherBufferSize:           cfg.DispatcherBufferSize,
+		Thresholds:                     cfg.Thresholds,
+		EnableMetrics:                  cfg.EnableMetrics,
+		MetricsInterval:                cfg.MetricsInterval,
+		LevelPolicy:                    cfg.LevelPolicy,
+		ExitThresholds:                 cfg.ExitThresholds,
+		Resources:                      cfg.Resources,
+		LevelMinDwell:                  cfg.LevelMinDwell,
+		CircuitBreakerMode:             cfg.CircuitBreakerMode,
+		CircuitBreakerHybridThreshold:  cfg.CircuitBreakerHybridThreshold,
+		CircuitBreakerMaxFailures:      cfg.CircuitBreakerMaxFailures,
+		CircuitBreakerTimeout:          cfg.CircuitBreakerTimeout,
+		CircuitBreakerSuccessThreshold: cfg.CircuitBreakerSuccessThreshold,
+		TrackerAlpha:                   cfg.TrackerAlpha,
+		TrackerWindowSize:              cfg.TrackerWindowSize,
+		TrackerSampleSize:              cfg.TrackerSampleSize,
+		TrackerDecayHalfLife:           cfg.TrackerDecayHalfLife,
+		TrackerTimeWindow:              cfg.TrackerTimeWindow,
+		TrackerQuantiles:               cfg.TrackerQuantiles,
+		TrackerQuantileEstimator:       cfg.TrackerQuantileEstimator,
+		ProbeRatio:                     cfg.ProbeRatio,
+		Shedding:                       cfg.Shedding,
+		DeadlinePercentile:             cfg.DeadlinePercentile,
+		DeadlineMargin:                 cfg.DeadlineMargin,
+		TenantCacheSize:                cfg.TenantCacheSize,
+		Brownout:                       cfg.Brownout,
+		Shadow:                         cfg.Shadow,
+		ShadowEnforceRatio:             cfg.ShadowEnforceRatio,
+		ConcurrencyLimiter:             cfg.ConcurrencyLimiter,
+		RetryAfterEmergency:            cfg.RetryAfterEmergency,
+		RetryAfterCritical:             cfg.RetryAfterCritical,
+		RetryAfterCircuit:              cfg.RetryAfterCircuit,
+		Logger:                         cfg.Logger,
+		Metrics:                        cfg.Metrics,
+		Tracer:                         cfg.Tracer,
+		OnLevelChange:                  cfg.OnLevelChange,
+		OnCircuitStateChange:           cfg.OnCircuitStateChange,
+	}
+}
+
+// interceptor adapts a floodgate.Gate to the unary and stream interceptors.
+type interceptor struct {
+	gate           *floodgate.Gate
+	skipMethods    []string
+	criticalityKey string
+	tenantFunc     func(ctx context.Context) string
+
+	retryAfterCircuit   md.MD
+	retryAfterEmergency md.MD
+	retryAfterCritical  md.MD
+}
+
 // UnaryServerInterceptor creates a gRPC unary server interceptor with adaptive backpressure.
 func UnaryServerInterceptor(ctx context.Context, cfg Config) grpc.UnaryServerInterceptor {
-	registry := expirable.NewLRU[string, floodgate.Tracker[time.Duration, floodgate.Stats]](
-		cfg.CacheSize,
-		nil,
-		cfg.CacheTTL,
-	)
-
-	dispatcher := floodgate.NewDispatcher[time.Duration](ctx, cfg.DispatcherBufferSize)
-	circuitBreaker := floodgate.NewCircuitBreaker(
-		cfg.CircuitBreakerMaxFailures,
-		cfg.CircuitBreakerTimeout,
-		cfg.CircuitBreakerSuccessThreshold,
-	)
-	skipMethods := cfg.SkipMethods
-
-	// Use provided logger or default
-	logger := cfg.Logger
-	if logger == nil {
-		logger = floodgate.NewDefaultLogger()
-	}
-
-	// Use provided metrics or no-op
-	metrics := cfg.Metrics
-	if metrics == nil {
-		metrics = &floodgate.NoOpMetrics{}
-	}
-
-	// Pre-allocate metadata to avoid allocation on hot path
-	retryAfterCircuit := md.Pairs("retry-after", fmt.Sprintf("%d", cfg.RetryAfterCircuit))
-	retryAfterEmergency := md.Pairs("retry-after", fmt.Sprintf("%d", cfg.RetryAfterEmergency))
-	retryAfterCritical := md.Pairs("retry-after", fmt.Sprintf("%d", cfg.RetryAfterCritical))
-
-	// Periodic metrics
-	if cfg.EnableMetrics {
-		go func() {
-			ticker := time.NewTicker(cfg.MetricsInterval)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					cacheLen := registry.Len()
-					dropRate := dispatcher.DropRate()
-
-					// Record cache and dispatcher metrics
-					metrics.RecordCacheSize(cacheLen)
-					metrics.RecordDispatcherStats(dispatcher.DroppedCount(), dispatcher.TotalCount())
-
-					if cacheLen > 0 || dropRate > 0 {
-						logger.InfoContext(ctx, "backpressure metrics",
-							"cache_used", cacheLen,
-							"cache_size", cfg.CacheSize,
-							"cache_pct", float64(cacheLen)/float64(cfg.CacheSize)*100,
-							"drops", dispatcher.DroppedCount(),
-							"total", dispatcher.TotalCount(),
-							"drop_rate", dropRate,
-							"circuit", circuitBreaker.State())
-					}
-				}
+	return newInterceptor(ctx, cfg).unary
+}
+
+// StreamServerInterceptor creates a gRPC stream server interceptor with adaptive backpressure.
+// Admission is checked once when the stream opens. Handler time per message is tracked
+// apart from unary latency and holds back new streams once it is overloaded. Whole-stream
+// durations are not tracked.
+func StreamServerInterceptor(ctx context.Context, cfg Config) grpc.StreamServerInterceptor {
+	return newInterceptor(ctx, cfg).stream
+}
+
+// ServerInterceptors creates unary and stream server interceptors that share the same
+// tracker registry, dispatcher, circuit breakers and metrics collector.
+//
+// Example:
+//
+//	unary, stream := bpgrpc.ServerInterceptors(ctx, cfg)
+//	server := grpc.NewServer(
+//	    grpc.UnaryInterceptor(unary),
+//	    grpc.StreamInterceptor(stream),
+//	)
+func ServerInterceptors(ctx context.Context, cfg Config) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	i := newInterceptor(ctx, cfg)
+	return i.unary, i.stream
+}
+
+func newInterceptor(ctx context.Context, cfg Config) *interceptor {
+	i := &interceptor{
+		gate:           floodgate.NewGate(ctx, cfg.gateConfig()),
+		skipMethods:    cfg.SkipMethods,
+		criticalityKey: strings.ToLower(cfg.CriticalityMetadataKey),
+
+		// Pre-allocate metadata to avoid allocation on hot path
+		retryAfterCircuit:   md.Pairs("retry-after", fmt.Sprintf("%d", cfg.RetryAfterCircuit)),
+		retryAfterEmergency: md.Pairs("retry-after", fmt.Sprintf("%d", cfg.RetryAfterEmergency)),
+		retryAfterCritical:  md.Pairs("retry-after", fmt.Sprintf("%d", cfg.RetryAfterCritical)),
+	}
+
+	i.tenantFunc = cfg.TenantFunc
+	if i.tenantFunc == nil && cfg.TenantMetadataKey != "" {
+		tenantKey := strings.ToLower(cfg.TenantMetadataKey)
+		i.tenantFunc = func(ctx context.Context) string {
+			if values := md.ValueFromIncomingContext(ctx, tenantKey); len(values) > 0 {
+				return values[0]
 			}
-		}()
+			return ""
+		}
+	}
+
+	if cfg.Debug != nil {
+		cfg.Debug.Register("grpc", i.gate.Snapshot)
 	}
 
-	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-		method := info.FullMethod
+	return i
+}
+
+// skip reports whether method bypasses backpressure.
+func (i *interceptor) skip(method string) bool {
+	// Fast prefix check (optimized for small n=2-3 prefixes)
+	for _, skipPrefix := range i.skipMethods {
+		if strings.HasPrefix(method, skipPrefix) {
+			return true
+		}
+	}
+	return false
+}
 
-		// Fast prefix check (optimized for small n=2-3 prefixes)
-		for _, skipPrefix := range skipMethods {
-			if strings.HasPrefix(method, skipPrefix) {
-				return handler(ctx, req)
+// withRequestInfo returns ctx carrying the request tier and tenant from
+// incoming metadata, if configured and present.
+func (i *interceptor) withRequestInfo(ctx context.Context) context.Context {
+	if i.criticalityKey != "" {
+		if values := md.ValueFromIncomingContext(ctx, i.criticalityKey); len(values) > 0 {
+			if tier, ok := floodgate.ParseCriticality(values[0]); ok {
+				ctx = floodgate.WithCriticality(ctx, tier)
 			}
 		}
+	}
 
-		tracker, ok := registry.Get(method)
-		if !ok {
-			tracker = floodgate.NewTracker(
-				floodgate.WithAlpha(cfg.TrackerAlpha),
-				floodgate.WithWindowSize(cfg.TrackerWindowSize),
-				floodgate.WithPercentiles(cfg.TrackerSampleSize),
-			)
-			registry.Add(method, tracker)
+	if i.tenantFunc != nil {
+		if tenant := i.tenantFunc(ctx); tenant != "" {
+			ctx = floodgate.WithTenant(ctx, tenant)
 		}
+	}
 
-		if !circuitBreaker.Allow() {
-			_ = grpc.SetTrailer(ctx, retryAfterCircuit)
-			logger.WarnContext(ctx, "circuit breaker open", "method", method)
-			metrics.RecordCircuitBreakerState(method, circuitBreaker.State())
+	return ctx
+}
 
-			// Record rejected request
-			metrics.RecordRequest(ctx, floodgate.RequestLabels{
-				Method: method,
-				Level:  floodgate.Emergency,
-				Result: "rejected",
-			}, 0, true)
+// rejectError sets the retry-after trailer for a gate rejection and converts
+// it to a status error.
+func (i *interceptor) rejectError(err error, setTrailer func(md.MD)) error {
+	overloaded, ok := err.(floodgate.ErrOverloaded)
+	if !ok {
+		return err
+	}
 
-			return nil, status.Errorf(codes.Unavailable, "service circuit breaker open")
-		}
+	switch overloaded.Rejection {
+	case floodgate.RejectDeadline:
+		return status.Errorf(codes.DeadlineExceeded, "deadline too short - expected latency exceeds remaining time")
+	case floodgate.RejectCircuitOpen:
+		setTrailer(i.retryAfterCircuit)
+		return status.Errorf(codes.Unavailable, "service circuit breaker open")
+	case floodgate.RejectEmergency:
+		setTrailer(i.retryAfterEmergency)
+	default:
+		setTrailer(i.retryAfterCritical)
+	}
+	return status.Errorf(codes.ResourceExhausted, "service overloaded - %s", overloaded.Rejection)
+}
 
-		stats := tracker.Value()
-		level := stats.LevelWithThresholds(cfg.Thresholds)
-
-		var rejected bool
-
-		switch level {
-		case floodgate.Emergency:
-			circuitBreaker.RecordFailure()
-			_ = grpc.SetTrailer(ctx, retryAfterEmergency)
-			logger.ErrorContext(ctx, "backpressure emergency",
-				"method", method,
-				"ema", stats.EMA,
-				"p95", stats.P95,
-				"p99", stats.P99)
-			rejected = true
-			metrics.RecordCircuitBreakerState(method, circuitBreaker.State())
-			metrics.RecordRequest(ctx, floodgate.RequestLabels{
-				Method: method,
-				Level:  level,
-				Result: "rejected",
-			}, 0, true)
-			return nil, status.Errorf(codes.ResourceExhausted, "service overloaded - emergency backpressure")
-
-		case floodgate.Critical:
-			circuitBreaker.RecordFailure()
-			_ = grpc.SetTrailer(ctx, retryAfterCritical)
-			logger.ErrorContext(ctx, "backpressure critical",
-				"method", method,
-				"ema", stats.EMA,
-				"p95", stats.P95,
-				"p99", stats.P99)
-			rejected = true
-			metrics.RecordCircuitBreakerState(method, circuitBreaker.State())
-			metrics.RecordRequest(ctx, floodgate.RequestLabels{
-				Method: method,
-				Level:  level,
-				Result: "rejected",
-			}, 0, true)
-			return nil, status.Errorf(codes.ResourceExhausted, "service overloaded - critical backpressure")
-
-		case floodgate.Warning, floodgate.Moderate:
-			logger.WarnContext(ctx, "backpressure detected",
-				"level", level,
-				"method", method,
-				"ema", stats.EMA,
-				"p95", stats.P95,
-				"p99", stats.P99)
-
-		case floodgate.Normal:
-			circuitBreaker.RecordSuccess()
-			metrics.RecordCircuitBreakerState(method, circuitBreaker.State())
-		}
+func (i *interceptor) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	method := info.FullMethod
+	if i.skip(method) {
+		return handler(ctx, req)
+	}
 
-		start := time.Now()
-		resp, err := handler(ctx, req)
-		latency := time.Since(start)
+	ctx = i.withRequestInfo(ctx)
+	decision, err := i.gate.Admit(ctx, method)
+	if err != nil {
+		return nil, i.rejectError(err, func(trailer md.MD) {
+			_ = grpc.SetTrailer(ctx, trailer)
+		})
+	}
 
-		dispatcher.Emit(tracker, latency)
+	start := time.Now()
+	resp, err := handler(floodgate.NewContext(ctx, decision), req)
+	decision.Done(time.Since(start), err)
 
-		// Record successful request completion
-		result := "success"
-		if err != nil {
-			result = "error"
-		}
-		metrics.RecordRequest(ctx, floodgate.RequestLabels{
-			Method: method,
-			Level:  level,
-			Result: result,
-		}, latency, rejected)
+	return resp, err
+}
+
+func (i *interceptor) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	method := info.FullMethod
+	if i.skip(method) {
+		return handler(srv, ss)
+	}
+
+	ctx := i.withRequestInfo(ss.Context())
+	decision, err := i.gate.AdmitStream(ctx, method)
+	if err != nil {
+		return i.rejectError(err, ss.SetTrailer)
+	}
+
+	start := time.Now()
+	wrapped := &monitoredStream{
+		ServerStream: ss,
+		ctx:          floodgate.NewContext(ctx, decision),
+		decision:     decision,
+	}
+
+	err = handler(srv, wrapped)
+	decision.Done(time.Since(start), err)
+
+	return err
+}
+
+// monitoredStream wraps a grpc.ServerStream and reports per-message handler latency:
+// the time from a RecvMsg returning to the next SendMsg. Time spent blocked in
+// RecvMsg waiting for the client, and idle gaps between sends with no message
+// received in between, are not counted.
+type monitoredStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	decision floodgate.Decision
+
+	// receivedAt is when the last RecvMsg returned a message that has not
+	// been answered yet, in Unix nanoseconds, or zero. It is accessed
+	// atomically because SendMsg and RecvMsg may be called from different
+	// goroutines.
+	receivedAt atomic.Int64
+}
+
+// Context returns the stream context, carrying the request tier, tenant and
+// admission decision.
+func (s *monitoredStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *monitoredStream) SendMsg(m any) error {
+	if receivedAt := s.receivedAt.Swap(0); receivedAt != 0 {
+		s.decision.Observe(time.Duration(time.Now().UnixNano() - receivedAt))
+	}
+	return s.ServerStream.SendMsg(m)
+}
 
-		return resp, err
+func (s *monitoredStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.receivedAt.Store(time.Now().UnixNano())
 	}
+	return err
 }
@@ -2,11 +2,15 @@ package grpc
 
 import (
 	"context"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/mushtruk/floodgate"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	md "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // Mock handler for testing
@@ -246,3 +250,204 @@ func TestInterceptor_CircuitBreaker(t *testing.T) {
 	// without exposing circuit breaker state, so just verify no panic
 	_, _ = interceptor(ctx, nil, info, mockHandler)
 }
+
+// mockServerStream is a grpc.ServerStream whose RecvMsg blocks for recvDelay,
+// simulating a client that sends messages slowly.
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	recvDelay time.Duration
+	recvLeft  int
+	sent      int
+}
+
+func (s *mockServerStream) Context() context.Context { return s.ctx }
+
+func (s *mockServerStream) SetTrailer(md.MD) {}
+
+func (s *mockServerStream) SendMsg(m any) error {
+	s.sent++
+	return nil
+}
+
+func (s *mockServerStream) RecvMsg(m any) error {
+	if s.recvLeft == 0 {
+		return io.EOF
+	}
+	s.recvLeft--
+	time.Sleep(s.recvDelay)
+	return nil
+}
+
+// echoStreamHandler echoes every received message until the client is done.
+func echoStreamHandler(srv any, stream grpc.ServerStream) error {
+	for {
+		var msg any
+		if err := stream.RecvMsg(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Test stream interceptor basic flow
+func TestStreamInterceptor_BasicFlow(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+
+	interceptor := StreamServerInterceptor(ctx, cfg)
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Chat"}
+	ss := &mockServerStream{ctx: ctx, recvLeft: 3}
+
+	if err := interceptor(nil, ss, info, echoStreamHandler); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ss.sent != 3 {
+		t.Fatalf("Expected 3 messages sent, got %d", ss.sent)
+	}
+}
+
+// Test long-lived streams do not count as per-method latency
+func TestStreamInterceptor_StreamDurationDoesNotPoisonTracker(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.Thresholds = floodgate.Thresholds{
+		P99Emergency: 50 * time.Millisecond,
+		P95Critical:  20 * time.Millisecond,
+		EMACritical:  10 * time.Millisecond,
+		P95Moderate:  10 * time.Millisecond,
+		EMAWarning:   5 * time.Millisecond,
+		SlopeWarning: 1 * time.Millisecond,
+	}
+
+	_, interceptor := ServerInterceptors(ctx, cfg)
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Chat"}
+
+	// Each stream lives well past every threshold while the client is idle
+	for i := 0; i < 12; i++ {
+		ss := &mockServerStream{ctx: ctx, recvDelay: 5 * time.Millisecond, recvLeft: 5}
+		if err := interceptor(nil, ss, info, echoStreamHandler); err != nil {
+			t.Fatalf("Stream %d: expected no error, got %v", i, err)
+		}
+	}
+}
+
+// Test idle gaps between server pushes do not count as per-message latency
+func TestStreamInterceptor_IdleGapsDoNotPoisonTracker(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.Thresholds = floodgate.Thresholds{
+		P99Emergency: 50 * time.Millisecond,
+		P95Critical:  20 * time.Millisecond,
+		EMACritical:  10 * time.Millisecond,
+		P95Moderate:  10 * time.Millisecond,
+		EMAWarning:   5 * time.Millisecond,
+		SlopeWarning: 1 * time.Millisecond,
+	}
+
+	_, interceptor := ServerInterceptors(ctx, cfg)
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Watch"}
+
+	// A watch receives one request, then pushes events as they happen
+	watch := func(srv any, stream grpc.ServerStream) error {
+		var req any
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				time.Sleep(60 * time.Millisecond)
+			}
+			if err := stream.SendMsg(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := 0; i < 4; i++ {
+		ss := &mockServerStream{ctx: ctx, recvLeft: 1}
+		if err := interceptor(nil, ss, info, watch); err != nil {
+			t.Fatalf("Stream %d: expected no error, got %v", i, err)
+		}
+	}
+}
+
+// Test requests over the concurrency limit are rejected
+func TestInterceptor_ConcurrencyLimit(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.ConcurrencyLimiter = func() *floodgate.Limiter {
+		return floodgate.NewLimiter(floodgate.AIMDLimit{}, 1, 1, 1)
+	}
+
+	interceptor := UnaryServerInterceptor(ctx, cfg)
+	info := mockInfo("/test.Service/Method")
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+			close(started)
+			<-unblock
+			return "response", nil
+		})
+		done <- err
+	}()
+	<-started
+
+	_, err := interceptor(ctx, nil, info, mockHandler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted over the limit, got %v", err)
+	}
+
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatalf("Expected in-flight request to succeed, got %v", err)
+	}
+
+	if _, err := interceptor(ctx, nil, info, mockHandler); err != nil {
+		t.Fatalf("Expected request to be admitted after release, got %v", err)
+	}
+}
+
+func TestInterceptor_DeadlineTooShort(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.DeadlinePercentile = 0.95
+
+	interceptor := UnaryServerInterceptor(ctx, cfg)
+	info := mockInfo("/test.Service/Slow")
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		time.Sleep(20 * time.Millisecond)
+		return "response", nil
+	}
+	for range 15 {
+		if _, err := interceptor(ctx, nil, info, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	short, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	if _, err := interceptor(short, nil, info, handler); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
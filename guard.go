@@ -0,0 +1,77 @@
+package floodgate
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Do runs fn if gate admits a call to key and times it into key's tracker.
+// If the call is rejected, fn is not run and Do returns an ErrOverloaded
+// carrying the level and suggested retry delay. fn's context carries the
+// admission decision; see FromContext.
+//
+// Example:
+//
+//	err := floodgate.Do(ctx, gate, "s3.PutObject", func(ctx context.Context) error {
+//	    _, err := s3.PutObject(ctx, input)
+//	    return err
+//	})
+func Do(ctx context.Context, gate *Gate, key string, fn func(ctx context.Context) error) error {
+	_, err := DoValue(ctx, gate, key, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// DoValue is like Do for functions that return a result.
+//
+// Example:
+//
+//	user, err := floodgate.DoValue(ctx, gate, "users.Get", func(ctx context.Context) (*User, error) {
+//	    return db.GetUser(ctx, id)
+//	})
+func DoValue[T any](ctx context.Context, gate *Gate, key string, fn func(ctx context.Context) (T, error)) (result T, err error) {
+	decision, err := gate.Admit(ctx, key)
+	if err != nil {
+		return result, err
+	}
+
+	start := time.Now()
+	completed := false
+	defer func() {
+		// Release the decision even if fn panics
+		if !completed {
+			decision.Done(time.Since(start), errPanicked)
+		}
+	}()
+
+	result, err = fn(NewContext(ctx, decision))
+	completed = true
+	decision.Done(time.Since(start), err)
+	return result, err
+}
+
+// errPanicked is recorded as the outcome of a guarded call that panicked.
+var errPanicked = errors.New("floodgate: guarded call panicked")
+
+// Guard binds a gate to a key for repeated calls of the same operation.
+//
+// Example:
+//
+//	putObject := floodgate.NewGuard(gate, "s3.PutObject")
+//	err := putObject.Do(ctx, func(ctx context.Context) error { ... })
+type Guard struct {
+	gate *Gate
+	key  string
+}
+
+// NewGuard creates a guard for key.
+func NewGuard(gate *Gate, key string) Guard {
+	return Guard{gate: gate, key: key}
+}
+
+// Do runs fn through the guard's gate and key. See the package-level Do.
+func (g Guard) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Do(ctx, g.gate, g.key, fn)
+}
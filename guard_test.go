@@ -0,0 +1,97 @@
+package floodgate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDoValue(t *testing.T) {
+	ctx := context.Background()
+	gate := NewGate(ctx, testGateConfig())
+
+	value, err := DoValue(ctx, gate, "users.Get", func(ctx context.Context) (string, error) {
+		return "alice", nil
+	})
+	if err != nil || value != "alice" {
+		t.Fatalf("Expected alice, got %q (%v)", value, err)
+	}
+
+	failure := errors.New("not found")
+	if err := Do(ctx, gate, "users.Get", func(ctx context.Context) error { return failure }); err != failure {
+		t.Errorf("Expected the function's error, got %v", err)
+	}
+}
+
+func TestDo_Rejected(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Critical, ReasonP95EMACritical
+	})
+	guard := NewGuard(NewGate(ctx, cfg), "s3.PutObject")
+
+	called := false
+	err := guard.Do(ctx, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+
+	var overloaded ErrOverloaded
+	if !errors.As(err, &overloaded) || overloaded.Level != Critical {
+		t.Fatalf("Expected critical ErrOverloaded, got %v", err)
+	}
+	if overloaded.RetryAfter != time.Duration(cfg.RetryAfterCritical)*time.Second {
+		t.Errorf("Expected critical retry-after, got %v", overloaded.RetryAfter)
+	}
+	if called {
+		t.Error("Expected rejected function not to run")
+	}
+}
+
+func TestDo_PanicReleasesLimiter(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.ConcurrencyLimiter = func() *Limiter {
+		return NewLimiter(AIMDLimit{}, 1, 1, 1)
+	}
+	gate := NewGate(ctx, cfg)
+
+	func() {
+		defer func() { _ = recover() }()
+		_ = Do(ctx, gate, "jobs", func(ctx context.Context) error { panic("boom") })
+	}()
+
+	if err := Do(ctx, gate, "jobs", func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected slot to be released after panic, got %v", err)
+	}
+}
+
+func TestDo_DecisionInContext(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGateConfig()
+	cfg.Brownout = true
+	cfg.LevelPolicy = LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Moderate, ReasonP95Moderate
+	})
+	gate := NewGate(ctx, cfg)
+
+	err := Do(ctx, gate, "feed", func(ctx context.Context) error {
+		admission, ok := FromContext(ctx)
+		if !ok {
+			t.Fatal("Expected decision in context")
+		}
+		if admission.Level != Moderate || admission.Reason != ReasonP95Moderate || !admission.Degrade {
+			t.Errorf("Unexpected decision: %+v", admission)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := FromContext(ctx); ok {
+		t.Error("Expected no decision outside a guarded call")
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/mushtruk/floodgate"
 )
 
@@ -18,11 +18,33 @@ type Config struct {
 	CacheTTL             time.Duration
 	DispatcherBufferSize int
 	Thresholds           floodgate.Thresholds
-	SkipPaths            []string
 	EnableMetrics        bool
 	MetricsInterval      time.Duration
 
-	// Circuit breaker configuration
+	// LevelPolicy decides the backpressure level from a route's stats.
+	// If nil, uses ThresholdPolicy with Thresholds.
+	LevelPolicy floodgate.LevelPolicy
+
+	// ExitThresholds are the thresholds stats must fall below before a route's
+	// level de-escalates. Keeping them below Thresholds stops a route hovering
+	// around a threshold from flapping. If zero, uses Thresholds scaled by
+	// DefaultExitRatio. Ignored when LevelPolicy is set.
+	ExitThresholds floodgate.Thresholds
+
+	// Resources, if set, combines the process-wide resource level with every
+	// route's latency level; the more severe one wins. One monitor can be
+	// shared by several gates.
+	Resources *floodgate.ResourceMonitor
+
+	// LevelMinDwell is the minimum time a route stays at a level before it
+	// de-escalates. Zero de-escalates as soon as stats allow.
+	LevelMinDwell time.Duration
+
+	// Circuit breaker configuration. CircuitBreakerMode selects per-route,
+	// global or hybrid breakers; in hybrid mode every route is rejected while
+	// CircuitBreakerHybridThreshold per-route breakers are open.
+	CircuitBreakerMode             floodgate.CircuitMode
+	CircuitBreakerHybridThreshold  int
 	CircuitBreakerMaxFailures      int
 	CircuitBreakerTimeout          time.Duration
 	CircuitBreakerSuccessThreshold int
@@ -32,7 +54,87 @@ type Config struct {
 	TrackerWindowSize int
 	TrackerSampleSize int
 
-	// Retry-after headers (seconds)
+	// TrackerDecayHalfLife makes stats decay once no samples arrive, so a
+	// route that is being rejected recovers without waiting for CacheTTL.
+	// Zero disables decay.
+	TrackerDecayHalfLife time.Duration
+
+	// TrackerTimeWindow makes percentiles and trend describe the last window
+	// of traffic rather than the last TrackerSampleSize requests. Zero uses a
+	// sample-count window.
+	TrackerTimeWindow time.Duration
+
+	// TrackerQuantiles are quantiles tracked per route in addition to P50, P95
+	// and P99, e.g. 0.9 and 0.999. They can be used in Thresholds.Quantiles
+	// and are reported through Metrics and the Tracer.
+	TrackerQuantiles []float64
+
+	// TrackerQuantileEstimator creates the percentile estimator for each route,
+	// e.g. a DDSketch, in place of the exact TrackerSampleSize sample buffer.
+	// If nil, percentiles are exact.
+	TrackerQuantileEstimator func() floodgate.QuantileEstimator
+
+	// ProbeRatio is the fraction of requests admitted at Critical and Emergency
+	// levels so the tracker keeps seeing fresh latency. Zero disables probing.
+	ProbeRatio float64
+
+	// Shedding rejects a fraction of requests at Moderate and Critical,
+	// instead of rejecting all of them at Critical. Shed requests do not trip
+	// the circuit breaker. Emergency still rejects every request and counts
+	// towards the breaker. If nil, rejection is all-or-nothing.
+	Shedding floodgate.ShedPolicy
+
+	// DeadlinePercentile enables deadline-aware admission: a request whose
+	// context deadline leaves less time than this percentile of its route's
+	// latency plus DeadlineMargin is rejected with RejectDeadline instead of
+	// running only to time out. See Stats.Percentile for the supported values.
+	// Zero disables the check.
+	DeadlinePercentile float64
+
+	// DeadlineMargin is added to the latency estimate, e.g. to leave time
+	// for the response to reach the client.
+	DeadlineMargin time.Duration
+
+	// TenantCacheSize bounds the per-tenant state kept for fairness. Requests
+	// carry a tenant through WithTenant; once a route reaches Moderate, tenants
+	// holding more than their fair share of the route's in-flight requests, or
+	// of its recent load (the latency of requests completed over the last
+	// ten seconds or so), are rejected with RejectTenant before other tenants
+	// are affected.
+	// If zero, uses CacheSize.
+	TenantCacheSize int
+
+	// Brownout admits requests at Moderate and Critical with Decision.Degrade
+	// set instead of rejecting them, so handlers can degrade gracefully.
+	// Requests are still rejected at Emergency and while the circuit is open.
+	// Tiers shed below Critical are still shed from their Criticality.ShedLevel.
+	// Handlers read the decision with FromContext.
+	Brownout bool
+
+	// Shadow runs every check but only enforces ShadowEnforceRatio of the
+	// rejections. Requests that would have been rejected are logged, recorded
+	// with ResultWouldReject and let through. Levels and hooks keep working
+	// as usual, so they can be observed before rejection is switched on.
+	// Rejections that are not enforced count towards a separate shadow
+	// breaker per route, so they never open the real circuit breaker.
+	Shadow bool
+
+	// ShadowEnforceRatio is the fraction of rejections enforced in shadow
+	// mode, for a gradual rollout from 0 (log only) to 1 (enforce all).
+	ShadowEnforceRatio float64
+
+	// ConcurrencyLimiter creates the adaptive concurrency limiter for each route.
+	// Requests over the limit are rejected like critical backpressure.
+	// If nil, concurrency is not limited.
+	//
+	// Example:
+	//
+	//	cfg.ConcurrencyLimiter = func() *floodgate.Limiter {
+	//	    return floodgate.NewLimiter(floodgate.NewGradient2Limit(), 20, 1, 1000)
+	//	}
+	ConcurrencyLimiter func() *floodgate.Limiter
+
+	// Retry-after hints (seconds)
 	RetryAfterEmergency int
 	RetryAfterCritical  int
 	RetryAfterCircuit   int
@@ -42,6 +144,40 @@ type Config struct {
 
 	// Metrics collector for observability. If nil, uses NoOpMetrics (disabled).
 	Metrics floodgate.MetricsCollector
+
+	// Tracer records every admission decision as a span. If nil, uses NoOpTracer (disabled).
+	Tracer floodgate.Tracer
+
+	// OnLevelChange is called once per level transition of a route, with the
+	// stats that caused it. It runs on the request path, so it should return
+	// quickly. If nil, level changes are only logged.
+	OnLevelChange func(route string, from, to floodgate.Level, stats floodgate.Stats)
+
+	// OnCircuitStateChange is called once per state transition of a route's
+	// circuit breaker. In CircuitGlobal mode route is empty.
+	OnCircuitStateChange func(route string, from, to floodgate.CircuitState)
+
+	// SkipPaths lists path prefixes that bypass backpressure.
+	SkipPaths []string
+
+	// CriticalityHeader names the request header carrying the request tier,
+	// e.g. "X-Criticality: background". Values are parsed with
+	// floodgate.ParseCriticality. Clients can claim any tier, so only set it
+	// for trusted callers. If empty, tiers only come from
+	// floodgate.WithCriticality in earlier middleware.
+	CriticalityHeader string
+
+	// TenantHeader names the request header identifying the tenant, for
+	// per-tenant fairness. Ignored when TenantFunc is set.
+	TenantHeader string
+
+	// TenantFunc extracts the tenant from a request, e.g. from an
+	// authenticated principal. If both TenantFunc and TenantHeader are
+	// empty, tenants only come from floodgate.WithTenant in earlier middleware.
+	TenantFunc func(r *http.Request) string
+
+	// Debug, if set, exposes the live state of every tracked route under "http".
+	Debug *floodgate.DebugHandler
 }
 
 // DefaultConfig returns sensible default configuration.
@@ -58,7 +194,11 @@ func DefaultConfig() Config {
 		},
 		EnableMetrics:   true,
 		MetricsInterval: 1 * time.Minute,
+		LevelMinDwell:   2 * time.Second,
+		TenantCacheSize: 4096,
 
+		CircuitBreakerMode:             floodgate.CircuitPerKey,
+		CircuitBreakerHybridThreshold:  3,
 		CircuitBreakerMaxFailures:      3,
 		CircuitBreakerTimeout:          30 * time.Second,
 		CircuitBreakerSuccessThreshold: 5,
@@ -67,6 +207,9 @@ func DefaultConfig() Config {
 		TrackerWindowSize: 50,
 		TrackerSampleSize: 200,
 
+		TrackerDecayHalfLife: 10 * time.Second,
+		ProbeRatio:           0.01,
+
 		RetryAfterEmergency: 10,
 		RetryAfterCritical:  5,
 		RetryAfterCircuit:   30,
@@ -76,64 +219,68 @@ func DefaultConfig() Config {
 	}
 }
 
+// gateConfig returns the admission settings of cfg.
+func (cfg Config) gateConfig() floodgate.GateConfig {
+	return floodgate.GateConfig{
+		KeyName: "route",
+
+		CacheSize:                      cfg.CacheSize,
+		CacheTTL:                       cfg.CacheTTL,
+		DispatcherBufferSize:           cfg.DispatcherBufferSize,
+		Thresholds:                     cfg.Thresholds,
+		EnableMetrics:                  cfg.EnableMetrics,
+		MetricsInterval:                cfg.MetricsInterval,
+		LevelPolicy:                    cfg.LevelPolicy,
+		ExitThresholds:                 cfg.ExitThresholds,
+		Resources:                      cfg.Resources,
+		LevelMinDwell:                  cfg.LevelMinDwell,
+		CircuitBreakerMode:             cfg.CircuitBreakerMode,
+		CircuitBreakerHybridThreshold:  cfg.CircuitBreakerHybridThreshold,
+		CircuitBreakerMaxFailures:      cfg.CircuitBreakerMaxFailures,
+		CircuitBreakerTimeout:          cfg.CircuitBreakerTimeout,
+		CircuitBreakerSuccessThreshold: cfg.CircuitBreakerSuccessThreshold,
+		TrackerAlpha:                   cfg.TrackerAlpha,
+		TrackerWindowSize:              cfg.TrackerWindowSize,
+		TrackerSampleSize:              cfg.TrackerSampleSize,
+		TrackerDecayHalfLife:           cfg.TrackerDecayHalfLife,
+		TrackerTimeWindow:              cfg.TrackerTimeWindow,
+		TrackerQuantiles:               cfg.TrackerQuantiles,
+		TrackerQuantileEstimator:       cfg.TrackerQuantileEstimator,
+		ProbeRatio:                     cfg.ProbeRatio,
+		Shedding:                       cfg.Shedding,
+		DeadlinePercentile:             cfg.DeadlinePercentile,
+		DeadlineMargin:                 cfg.DeadlineMargin,
+		TenantCacheSize:                cfg.TenantCacheSize,
+		Brownout:                       cfg.Brownout,
+		Shadow:                         cfg.Shadow,
+		ShadowEnforceRatio:             cfg.ShadowEnforceRatio,
+		ConcurrencyLimiter:             cfg.ConcurrencyLimiter,
+		RetryAfterEmergency:            cfg.RetryAfterEmergency,
+		RetryAfterCritical:             cfg.RetryAfterCritical,
+		RetryAfterCircuit:              cfg.RetryAfterCircuit,
+		Logger:                         cfg.Logger,
+		Metrics:                        cfg.Metrics,
+		Tracer:                         cfg.Tracer,
+		OnLevelChange:                  cfg.OnLevelChange,
+		OnCircuitStateChange:           cfg.OnCircuitStateChange,
+	}
+}
+
 // Middleware creates an HTTP middleware with adaptive backpressure.
 func Middleware(ctx context.Context, cfg Config) func(http.Handler) http.Handler {
-	registry := expirable.NewLRU[string, floodgate.Tracker[time.Duration, floodgate.Stats]](
-		cfg.CacheSize,
-		nil,
-		cfg.CacheTTL,
-	)
-
-	dispatcher := floodgate.NewDispatcher[time.Duration](ctx, cfg.DispatcherBufferSize)
-	circuitBreaker := floodgate.NewCircuitBreaker(
-		cfg.CircuitBreakerMaxFailures,
-		cfg.CircuitBreakerTimeout,
-		cfg.CircuitBreakerSuccessThreshold,
-	)
+	gate := floodgate.NewGate(ctx, cfg.gateConfig())
 	skipPaths := cfg.SkipPaths
+	deadlineAware := cfg.DeadlinePercentile > 0
+	criticalityHeader := cfg.CriticalityHeader
 
-	// Use provided logger or default
-	logger := cfg.Logger
-	if logger == nil {
-		logger = floodgate.NewDefaultLogger()
+	tenantFunc := cfg.TenantFunc
+	if tenantFunc == nil && cfg.TenantHeader != "" {
+		tenantHeader := cfg.TenantHeader
+		tenantFunc = func(r *http.Request) string { return r.Header.Get(tenantHeader) }
 	}
 
-	// Use provided metrics or no-op
-	metrics := cfg.Metrics
-	if metrics == nil {
-		metrics = &floodgate.NoOpMetrics{}
-	}
-
-	// Periodic metrics
-	if cfg.EnableMetrics {
-		go func() {
-			ticker := time.NewTicker(cfg.MetricsInterval)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					cacheLen := registry.Len()
-					dropRate := dispatcher.DropRate()
-
-					// Record cache and dispatcher metrics
-					metrics.RecordCacheSize(cacheLen)
-					metrics.RecordDispatcherStats(dispatcher.DroppedCount(), dispatcher.TotalCount())
-
-					if cacheLen > 0 || dropRate > 0 {
-						logger.InfoContext(ctx, "backpressure metrics",
-							"cache_used", cacheLen,
-							"cache_size", cfg.CacheSize,
-							"cache_pct", float64(cacheLen)/float64(cfg.CacheSize)*100,
-							"drops", dispatcher.DroppedCount(),
-							"total", dispatcher.TotalCount(),
-							"drop_rate", dropRate,
-							"circuit", circuitBreaker.State())
-					}
-				}
-			}
-		}()
+	if cfg.Debug != nil {
+		cfg.Debug.Register("http", gate.Snapshot)
 	}
 
 	return func(next http.Handler) http.Handler {
@@ -151,99 +298,87 @@ func Middleware(ctx context.Context, cfg Config) func(http.Handler) http.Handler
 			// Route key: METHOD + path for more granular tracking
 			routeKey := r.Method + " " + path
 
-			tracker, ok := registry.Get(routeKey)
-			if !ok {
-				tracker = floodgate.NewTracker(
-					floodgate.WithAlpha(cfg.TrackerAlpha),
-					floodgate.WithWindowSize(cfg.TrackerWindowSize),
-					floodgate.WithPercentiles(cfg.TrackerSampleSize),
-				)
-				registry.Add(routeKey, tracker)
+			if criticalityHeader != "" {
+				if tier, ok := floodgate.ParseCriticality(r.Header.Get(criticalityHeader)); ok {
+					r = r.WithContext(floodgate.WithCriticality(r.Context(), tier))
+				}
 			}
 
-			if !circuitBreaker.Allow() {
-				w.Header().Set("Retry-After", fmt.Sprintf("%d", cfg.RetryAfterCircuit))
-				logger.WarnContext(r.Context(), "circuit breaker open", "route", routeKey)
-				metrics.RecordCircuitBreakerState(routeKey, circuitBreaker.State())
+			if tenantFunc != nil {
+				if tenant := tenantFunc(r); tenant != "" {
+					r = r.WithContext(floodgate.WithTenant(r.Context(), tenant))
+				}
+			}
 
-				// Record rejected request
-				metrics.RecordRequest(r.Context(), floodgate.RequestLabels{
-					Method: routeKey,
-					Level:  floodgate.Emergency,
-					Result: "rejected",
-				}, 0, true)
+			// Propagate a deadline set by a gRPC-aware proxy so the deadline
+			// check can see it
+			if deadlineAware {
+				if timeout, ok := parseGRPCTimeout(r.Header.Get("grpc-timeout")); ok {
+					ctx, cancel := context.WithTimeout(r.Context(), timeout)
+					defer cancel()
+					r = r.WithContext(ctx)
+				}
+			}
 
-				http.Error(w, "Service Unavailable - circuit breaker open", http.StatusServiceUnavailable)
+			decision, err := gate.Admit(r.Context(), routeKey)
+			if err != nil {
+				writeRejection(w, err)
 				return
 			}
 
-			stats := tracker.Value()
-			level := stats.LevelWithThresholds(cfg.Thresholds)
-
-			var rejected bool
-
-			switch level {
-			case floodgate.Emergency:
-				circuitBreaker.RecordFailure()
-				w.Header().Set("Retry-After", fmt.Sprintf("%d", cfg.RetryAfterEmergency))
-				logger.ErrorContext(r.Context(), "backpressure emergency",
-					"route", routeKey,
-					"ema", stats.EMA,
-					"p95", stats.P95,
-					"p99", stats.P99)
-				rejected = true
-				metrics.RecordCircuitBreakerState(routeKey, circuitBreaker.State())
-				metrics.RecordRequest(r.Context(), floodgate.RequestLabels{
-					Method: routeKey,
-					Level:  level,
-					Result: "rejected",
-				}, 0, true)
-				http.Error(w, "Service Unavailable - emergency backpressure", http.StatusServiceUnavailable)
-				return
+			start := time.Now()
+			next.ServeHTTP(w, r.WithContext(floodgate.NewContext(r.Context(), decision)))
+			decision.Done(time.Since(start), nil)
+		})
+	}
+}
 
-			case floodgate.Critical:
-				circuitBreaker.RecordFailure()
-				w.Header().Set("Retry-After", fmt.Sprintf("%d", cfg.RetryAfterCritical))
-				logger.ErrorContext(r.Context(), "backpressure critical",
-					"route", routeKey,
-					"ema", stats.EMA,
-					"p95", stats.P95,
-					"p99", stats.P99)
-				rejected = true
-				metrics.RecordCircuitBreakerState(routeKey, circuitBreaker.State())
-				metrics.RecordRequest(r.Context(), floodgate.RequestLabels{
-					Method: routeKey,
-					Level:  level,
-					Result: "rejected",
-				}, 0, true)
-				http.Error(w, "Service Unavailable - critical backpressure", http.StatusServiceUnavailable)
-				return
+// writeRejection responds to a request rejected by the gate with 503 and a
+// Retry-After header, or 504 if its deadline was too short.
+func writeRejection(w http.ResponseWriter, err error) {
+	overloaded, ok := err.(floodgate.ErrOverloaded)
+	if !ok {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
 
-			case floodgate.Warning, floodgate.Moderate:
-				logger.WarnContext(r.Context(), "backpressure detected",
-					"level", level,
-					"route", routeKey,
-					"ema", stats.EMA,
-					"p95", stats.P95,
-					"p99", stats.P99)
-
-			case floodgate.Normal:
-				circuitBreaker.RecordSuccess()
-				metrics.RecordCircuitBreakerState(routeKey, circuitBreaker.State())
-			}
+	if overloaded.Rejection == floodgate.RejectDeadline {
+		http.Error(w, "Gateway Timeout - "+string(overloaded.Rejection), http.StatusGatewayTimeout)
+		return
+	}
 
-			start := time.Now()
-			next.ServeHTTP(w, r)
-			latency := time.Since(start)
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(overloaded.RetryAfter/time.Second)))
+	http.Error(w, "Service Unavailable - "+string(overloaded.Rejection), http.StatusServiceUnavailable)
+}
 
-			dispatcher.Emit(tracker, latency)
+// parseGRPCTimeout parses a grpc-timeout header: up to 8 digits followed by a
+// unit of H, M, S, m (milliseconds), u (microseconds) or n (nanoseconds).
+func parseGRPCTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
 
-			// Record successful request completion
-			metrics.RecordRequest(r.Context(), floodgate.RequestLabels{
-				Method: routeKey,
-				Level:  level,
-				Result: "success",
-			}, latency, rejected)
-		})
+	var unit time.Duration
+	switch value[len(value)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+	if err != nil {
+		return 0, false
 	}
+	return time.Duration(n) * unit, true
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -324,3 +326,454 @@ func TestMiddleware_RetryAfterHeader(t *testing.T) {
 		t.Fatal("Expected Retry-After header during backpressure")
 	}
 }
+
+// Test a slow route trips only its own circuit breaker
+func TestMiddleware_PerRouteCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.CircuitBreakerMode = floodgate.CircuitPerKey
+	cfg.ProbeRatio = 0
+	cfg.Thresholds = floodgate.Thresholds{
+		P99Emergency: 50 * time.Millisecond,
+		P95Critical:  20 * time.Millisecond,
+		EMACritical:  10 * time.Millisecond,
+		P95Moderate:  10 * time.Millisecond,
+		EMAWarning:   5 * time.Millisecond,
+		SlopeWarning: 1 * time.Millisecond,
+	}
+
+	handler := Middleware(ctx, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/slow" {
+			time.Sleep(60 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Drive the slow route into emergency and trip its breaker
+	for i := 0; i < 30; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/slow", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		time.Sleep(time.Millisecond)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/slow", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected slow route to be rejected, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/fast", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected healthy route to be accepted, got %d", w.Code)
+	}
+}
+
+// Test a rejected route recovers once its stats decay
+func TestMiddleware_RecoversAfterDecay(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.ProbeRatio = 0
+	cfg.CircuitBreakerMaxFailures = 1000
+	cfg.TrackerDecayHalfLife = 20 * time.Millisecond
+	cfg.LevelMinDwell = 0
+	cfg.Thresholds = floodgate.Thresholds{
+		P99Emergency: 50 * time.Millisecond,
+		P95Critical:  20 * time.Millisecond,
+		EMACritical:  10 * time.Millisecond,
+		P95Moderate:  10 * time.Millisecond,
+		EMAWarning:   5 * time.Millisecond,
+		SlopeWarning: 1 * time.Millisecond,
+	}
+
+	handler := Middleware(ctx, cfg)(mockSlowHandler())
+
+	for i := 0; i < 12; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/slow", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/slow", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected route to be rejected, got %d", w.Code)
+	}
+
+	// 100ms samples need several half-lives to fall below the thresholds
+	time.Sleep(250 * time.Millisecond)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/slow", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected route to recover after decay, got %d", w.Code)
+	}
+}
+
+// Test probabilistic shedding never rejects every request below Emergency
+func TestMiddleware_Shedding(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.Shedding = floodgate.ProportionalShedding{MaxRatio: 0.5}
+	cfg.Thresholds = floodgate.Thresholds{
+		P99Emergency: time.Second, // Emergency rejects every request, even with shedding
+		P95Critical:  50 * time.Microsecond,
+		EMACritical:  10 * time.Microsecond,
+		P95Moderate:  10 * time.Microsecond,
+		EMAWarning:   5 * time.Microsecond,
+		SlopeWarning: 1 * time.Microsecond,
+	}
+
+	handler := Middleware(ctx, cfg)(mockHandler())
+
+	var accepted, shed int
+	for i := 0; i < 200; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		switch w.Code {
+		case http.StatusOK:
+			accepted++
+		case http.StatusServiceUnavailable:
+			shed++
+		}
+	}
+
+	if shed == 0 {
+		t.Error("Expected some requests to be shed")
+	}
+	if accepted < 50 {
+		t.Errorf("Expected roughly half of the requests to be accepted, got %d of 200", accepted)
+	}
+}
+
+func TestMiddleware_CustomLevelPolicy(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.ProbeRatio = 0
+	cfg.LevelPolicy = floodgate.LevelPolicyFunc(func(stats floodgate.Stats) (floodgate.Level, floodgate.Reason) {
+		if stats.EMA > 0 {
+			return floodgate.Critical, "always_critical"
+		}
+		return floodgate.Normal, floodgate.ReasonWithinThresholds
+	})
+
+	handler := Middleware(ctx, cfg)(mockHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected first request to pass, got %d", w.Code)
+	}
+
+	// Wait for the dispatcher to record the first latency
+	time.Sleep(50 * time.Millisecond)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected custom policy to reject, got %d", w.Code)
+	}
+}
+
+func TestMiddleware_OnLevelChange(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.ProbeRatio = 0
+	cfg.Thresholds = floodgate.Thresholds{
+		P99Emergency: time.Hour,
+		P95Critical:  100 * time.Microsecond,
+		EMACritical:  100 * time.Microsecond,
+		P95Moderate:  100 * time.Microsecond,
+		EMAWarning:   100 * time.Microsecond,
+		SlopeWarning: time.Hour,
+	}
+
+	var transitions []floodgate.Level
+	cfg.OnLevelChange = func(route string, from, to floodgate.Level, stats floodgate.Stats) {
+		if route != "GET /api/users" {
+			t.Errorf("Unexpected route %q", route)
+		}
+		transitions = append(transitions, to)
+	}
+
+	handler := Middleware(ctx, cfg)(mockHandler())
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if len(transitions) != 1 || transitions[0] != floodgate.Critical {
+		t.Errorf("Expected a single transition to critical, got %v", transitions)
+	}
+}
+
+// recordingTracer records admission decisions for tests.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	key      string
+	level    floodgate.Level
+	rejected bool
+	ended    bool
+}
+
+func (t *recordingTracer) StartDecision(ctx context.Context, key string) floodgate.DecisionSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordingSpan{key: key}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func (s *recordingSpan) RecordDecision(stats floodgate.Stats, level floodgate.Level, rejected bool) {
+	s.level, s.rejected = level, rejected
+}
+
+func (s *recordingSpan) RecordCircuitBreakerState(state floodgate.CircuitState, rejected bool) {}
+
+func (s *recordingSpan) End() {
+	s.ended = true
+}
+
+func TestMiddleware_Tracer(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.ProbeRatio = 0
+	cfg.Thresholds = floodgate.Thresholds{
+		P99Emergency: time.Hour,
+		P95Critical:  100 * time.Microsecond,
+		EMACritical:  100 * time.Microsecond,
+		P95Moderate:  100 * time.Microsecond,
+		EMAWarning:   100 * time.Microsecond,
+		SlopeWarning: time.Hour,
+	}
+	tracer := &recordingTracer{}
+	cfg.Tracer = tracer
+
+	handler := Middleware(ctx, cfg)(mockHandler())
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	var admitted, rejected int
+	for _, span := range tracer.spans {
+		if !span.ended {
+			t.Fatal("Expected every decision span to be ended")
+		}
+		if span.key != "GET /api/users" {
+			t.Errorf("Unexpected span key %q", span.key)
+		}
+		if span.rejected {
+			rejected++
+		} else {
+			admitted++
+		}
+	}
+
+	if len(tracer.spans) != 20 {
+		t.Errorf("Expected a span per request, got %d", len(tracer.spans))
+	}
+	if admitted == 0 || rejected == 0 {
+		t.Errorf("Expected both admitted and rejected spans, got %d/%d", admitted, rejected)
+	}
+}
+
+func TestMiddleware_Debug(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.Debug = floodgate.NewDebugHandler()
+
+	handler := Middleware(ctx, cfg)(mockHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	cfg.Debug.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/floodgate?format=json", nil))
+
+	body := w.Body.String()
+	for _, want := range []string{`"name":"http"`, `"key":"GET /api/users"`, `"level":"normal"`, `"last_update"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected debug output to contain %s, got %s", want, body)
+		}
+	}
+}
+
+func TestMiddleware_DeadlineTooShort(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.DeadlinePercentile = 0.95
+
+	handler := Middleware(ctx, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+
+	for range 15 {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/report", nil))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/report", nil)
+	req.Header.Set("grpc-timeout", "5m")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 for a deadline shorter than P95, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "" {
+		t.Error("Expected no Retry-After for a deadline rejection")
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"100m", 100 * time.Millisecond, true},
+		{"2S", 2 * time.Second, true},
+		{"1H", time.Hour, true},
+		{"5", 0, false},
+		{"-5S", 0, false},
+		{"123456789S", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseGRPCTimeout(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseGRPCTimeout(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMiddleware_CriticalityHeader(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.CriticalityHeader = "X-Criticality"
+	cfg.LevelPolicy = floodgate.LevelPolicyFunc(func(floodgate.Stats) (floodgate.Level, floodgate.Reason) {
+		return floodgate.Warning, floodgate.ReasonEMAWarning
+	})
+
+	var tier floodgate.Criticality
+	handler := Middleware(ctx, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tier = floodgate.CriticalityFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/reindex", nil)
+	req.Header.Set("X-Criticality", "background")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected background request to be shed at Warning, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/reindex", nil)
+	req.Header.Set("X-Criticality", "critical")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || tier != floodgate.CriticalityCritical {
+		t.Errorf("Expected critical request to reach the handler, got %d with tier %v", w.Code, tier)
+	}
+}
+
+func TestMiddleware_TenantHeader(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.TenantHeader = "X-Tenant-ID"
+
+	var tenant string
+	handler := Middleware(ctx, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = floodgate.TenantFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if tenant != "acme" {
+		t.Errorf("Expected tenant acme in handler context, got %q", tenant)
+	}
+}
+
+func TestMiddleware_Brownout(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.Brownout = true
+	cfg.LevelPolicy = floodgate.LevelPolicyFunc(func(floodgate.Stats) (floodgate.Level, floodgate.Reason) {
+		return floodgate.Critical, floodgate.ReasonP95EMACritical
+	})
+
+	var degraded bool
+	handler := Middleware(ctx, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admission, _ := floodgate.FromContext(r.Context())
+		degraded = admission.Degrade
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/feed", nil))
+
+	if w.Code != http.StatusOK || !degraded {
+		t.Errorf("Expected degraded request to reach the handler, got %d (degrade=%v)", w.Code, degraded)
+	}
+}
+
+func TestMiddleware_Shadow(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = false
+	cfg.Logger = floodgate.NoOpLogger{}
+	cfg.Shadow = true
+	cfg.LevelPolicy = floodgate.LevelPolicyFunc(func(floodgate.Stats) (floodgate.Level, floodgate.Reason) {
+		return floodgate.Critical, floodgate.ReasonP95EMACritical
+	})
+
+	handler := Middleware(ctx, cfg)(mockHandler())
+
+	for range 10 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected shadow mode never to reject, got %d", w.Code)
+		}
+	}
+}
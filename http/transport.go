@@ -0,0 +1,486 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/mushtruk/floodgate"
+)
+
+// TransportConfig holds configuration for the backpressure client transport.
+// Hosts and routes are tracked as separate keys.
+type TransportConfig struct {
+	// Base sends the requests that are admitted. If nil, uses http.DefaultTransport.
+	Base http.RoundTripper
+
+	// CacheSize bounds the routes tracked. Hosts are tracked apart from
+	// routes, so a burst of distinct routes never evicts a host's breaker.
+	CacheSize            int
+	CacheTTL             time.Duration
+	DispatcherBufferSize int
+	Thresholds           floodgate.Thresholds
+	EnableMetrics        bool
+	MetricsInterval      time.Duration
+
+	// HostCacheSize bounds the hosts tracked. If zero, uses CacheSize.
+	HostCacheSize int
+
+	// LevelPolicy decides the backpressure level from a key's stats.
+	// If nil, uses ThresholdPolicy with Thresholds.
+	LevelPolicy floodgate.LevelPolicy
+
+	// ExitThresholds are the thresholds stats must fall below before a key's
+	// level de-escalates. Keeping them below Thresholds stops a key hovering
+	// around a threshold from flapping. If zero, uses Thresholds scaled by
+	// DefaultExitRatio. Ignored when LevelPolicy is set.
+	ExitThresholds floodgate.Thresholds
+
+	// Resources, if set, combines the process-wide resource level with every
+	// key's latency level; the more severe one wins. One monitor can be
+	// shared by several gates.
+	Resources *floodgate.ResourceMonitor
+
+	// LevelMinDwell is the minimum time a key stays at a level before it
+	// de-escalates. Zero de-escalates as soon as stats allow.
+	LevelMinDwell time.Duration
+
+	// Circuit breaker configuration. CircuitBreakerMode selects per-key,
+	// global or hybrid breakers; in hybrid mode every key is rejected while
+	// CircuitBreakerHybridThreshold per-key breakers are open. Every host also
+	// has a breaker for upstream failures, with the same settings: transport
+	// errors including timeouts, 5xx and 429 responses count as failures, and
+	// calls cancelled by the caller do not. Its state changes are recorded
+	// through Metrics.
+	CircuitBreakerMode             floodgate.CircuitMode
+	CircuitBreakerHybridThreshold  int
+	CircuitBreakerMaxFailures      int
+	CircuitBreakerTimeout          time.Duration
+	CircuitBreakerSuccessThreshold int
+
+	// Tracker configuration per key
+	TrackerAlpha      float32
+	TrackerWindowSize int
+	TrackerSampleSize int
+
+	// TrackerDecayHalfLife makes stats decay once no samples arrive, so a
+	// key that is being rejected recovers without waiting for CacheTTL.
+	// Zero disables decay.
+	TrackerDecayHalfLife time.Duration
+
+	// TrackerTimeWindow makes percentiles and trend describe the last window
+	// of traffic rather than the last TrackerSampleSize requests. Zero uses a
+	// sample-count window.
+	TrackerTimeWindow time.Duration
+
+	// TrackerQuantiles are quantiles tracked per key in addition to P50, P95
+	// and P99, e.g. 0.9 and 0.999. They can be used in Thresholds.Quantiles
+	// and are reported through Metrics and the Tracer.
+	TrackerQuantiles []float64
+
+	// TrackerQuantileEstimator creates the percentile estimator for each key,
+	// e.g. a DDSketch, in place of the exact TrackerSampleSize sample buffer.
+	// If nil, percentiles are exact.
+	TrackerQuantileEstimator func() floodgate.QuantileEstimator
+
+	// ProbeRatio is the fraction of requests admitted at Critical and Emergency
+	// levels so the tracker keeps seeing fresh latency. Zero disables probing.
+	ProbeRatio float64
+
+	// Shedding rejects a fraction of requests at Moderate and Critical,
+	// instead of rejecting all of them at Critical. Shed requests do not trip
+	// the circuit breaker. Emergency still rejects every request and counts
+	// towards the breaker. If nil, rejection is all-or-nothing.
+	Shedding floodgate.ShedPolicy
+
+	// DeadlinePercentile enables deadline-aware admission: a request whose
+	// context deadline leaves less time than this percentile of its key's
+	// latency plus DeadlineMargin is rejected with RejectDeadline instead of
+	// running only to time out. See Stats.Percentile for the supported values.
+	// Zero disables the check.
+	DeadlinePercentile float64
+
+	// DeadlineMargin is added to the latency estimate, e.g. to leave time
+	// for the response to reach the client.
+	DeadlineMargin time.Duration
+
+	// TenantCacheSize bounds the per-tenant state kept for fairness. Requests
+	// carry a tenant through WithTenant; once a key reaches Moderate, tenants
+	// holding more than their fair share of the key's in-flight requests, or
+	// of its recent load (the latency of requests completed over the last
+	// ten seconds or so), are rejected with RejectTenant before other tenants
+	// are affected.
+	// If zero, uses CacheSize.
+	TenantCacheSize int
+
+	// Shadow runs every check but only enforces ShadowEnforceRatio of the
+	// rejections. Requests that would have been rejected are logged, recorded
+	// with ResultWouldReject and let through. Levels and hooks keep working
+	// as usual, so they can be observed before rejection is switched on.
+	// Rejections that are not enforced count towards a separate shadow
+	// breaker per key, so they never open the real circuit breaker.
+	Shadow bool
+
+	// ShadowEnforceRatio is the fraction of rejections enforced in shadow
+	// mode, for a gradual rollout from 0 (log only) to 1 (enforce all).
+	ShadowEnforceRatio float64
+
+	// ConcurrencyLimiter creates the adaptive concurrency limiter for each key.
+	// Requests over the limit are rejected like critical backpressure.
+	// If nil, concurrency is not limited.
+	//
+	// Example:
+	//
+	//	cfg.ConcurrencyLimiter = func() *floodgate.Limiter {
+	//	    return floodgate.NewLimiter(floodgate.NewGradient2Limit(), 20, 1, 1000)
+	//	}
+	ConcurrencyLimiter func() *floodgate.Limiter
+
+	// MaxRetryAfter caps how long calls to a host are refused after it
+	// responds 503 or 429 with a Retry-After header. Zero ignores Retry-After.
+	MaxRetryAfter time.Duration
+
+	// Retry-after hints (seconds) for calls shed locally
+	RetryAfterEmergency int
+	RetryAfterCritical  int
+	RetryAfterCircuit   int
+
+	// Logger for backpressure events. If nil, uses DefaultLogger.
+	Logger floodgate.Logger
+
+	// Metrics collector for observability. If nil, uses NoOpMetrics (disabled).
+	Metrics floodgate.MetricsCollector
+
+	// Tracer records every admission decision as a span. If nil, uses NoOpTracer (disabled).
+	Tracer floodgate.Tracer
+
+	// OnLevelChange is called once per level transition of a key, with the
+	// stats that caused it. It runs on the request path, so it should return
+	// quickly. If nil, level changes are only logged.
+	OnLevelChange func(key string, from, to floodgate.Level, stats floodgate.Stats)
+
+	// OnCircuitStateChange is called once per state transition of a key's
+	// circuit breaker. In CircuitGlobal mode key is empty.
+	OnCircuitStateChange func(key string, from, to floodgate.CircuitState)
+
+	// Debug, if set, exposes the live state of every tracked host and route
+	// under "http-client".
+	Debug *floodgate.DebugHandler
+}
+
+// DefaultTransportConfig returns sensible default configuration.
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		CacheSize:            512,
+		CacheTTL:             2 * time.Minute,
+		DispatcherBufferSize: 1024,
+		Thresholds:           floodgate.DefaultThresholds(),
+		EnableMetrics:        true,
+		MetricsInterval:      1 * time.Minute,
+		LevelMinDwell:        2 * time.Second,
+		TenantCacheSize:      4096,
+
+		CircuitBreakerMode:             floodgate.CircuitPerKey,
+		CircuitBreakerHybridThreshold:  3,
+		CircuitBreakerMaxFailures:      5,
+		CircuitBreakerTimeout:          30 * time.Second,
+		CircuitBreakerSuccessThreshold: 3,
+
+		TrackerAlpha:         0.1,
+		TrackerWindowSize:    50,
+		TrackerSampleSize:    200,
+		TrackerDecayHalfLife: 10 * time.Second,
+
+		ProbeRatio:    0.01,
+		MaxRetryAfter: 5 * time.Minute,
+
+		RetryAfterEmergency: 10,
+		RetryAfterCritical:  5,
+		RetryAfterCircuit:   30,
+
+		Logger:  floodgate.NewDefaultLogger(),
+		Metrics: &floodgate.NoOpMetrics{},
+	}
+}
+
+// gateConfig returns the admission settings of cfg for the gate tracking
+// keyName keys.
+func (cfg TransportConfig) gateConfig(keyName string, cacheSize int) floodgate.GateConfig {
+	return floodgate.GateConfig{
+		KeyName:   keyName,
+		CacheSize: cacheSize,
+
+		CacheTTL:                       cfg.CacheTTL,
+		DispatcherBufferSize:           cfg.DispatcherBufferSize,
+		Thresholds:                     cfg.Thresholds,
+		EnableMetrics:                  cfg.EnableMetrics,
+		MetricsInterval:                cfg.MetricsInterval,
+		LevelPolicy:                    cfg.LevelPolicy,
+		ExitThresholds:                 cfg.ExitThresholds,
+		Resources:                      cfg.Resources,
+		LevelMinDwell:                  cfg.LevelMinDwell,
+		CircuitBreakerMode:             cfg.CircuitBreakerMode,
+		CircuitBreakerHybridThreshold:  cfg.CircuitBreakerHybridThreshold,
+		CircuitBreakerMaxFailures:      cfg.CircuitBreakerMaxFailures,
+		CircuitBreakerTimeout:          cfg.CircuitBreakerTimeout,
+		CircuitBreakerSuccessThreshold: cfg.CircuitBreakerSuccessThreshold,
+		TrackerAlpha:                   cfg.TrackerAlpha,
+		TrackerWindowSize:              cfg.TrackerWindowSize,
+		TrackerSampleSize:              cfg.TrackerSampleSize,
+		TrackerDecayHalfLife:           cfg.TrackerDecayHalfLife,
+		TrackerTimeWindow:              cfg.TrackerTimeWindow,
+		TrackerQuantiles:               cfg.TrackerQuantiles,
+		TrackerQuantileEstimator:       cfg.TrackerQuantileEstimator,
+		ProbeRatio:                     cfg.ProbeRatio,
+		Shedding:                       cfg.Shedding,
+		DeadlinePercentile:             cfg.DeadlinePercentile,
+		DeadlineMargin:                 cfg.DeadlineMargin,
+		TenantCacheSize:                cfg.TenantCacheSize,
+		Shadow:                         cfg.Shadow,
+		ShadowEnforceRatio:             cfg.ShadowEnforceRatio,
+		ConcurrencyLimiter:             cfg.ConcurrencyLimiter,
+		RetryAfterEmergency:            cfg.RetryAfterEmergency,
+		RetryAfterCritical:             cfg.RetryAfterCritical,
+		RetryAfterCircuit:              cfg.RetryAfterCircuit,
+		Logger:                         cfg.Logger,
+		Metrics:                        cfg.Metrics,
+		Tracer:                         cfg.Tracer,
+		OnLevelChange:                  cfg.OnLevelChange,
+		OnCircuitStateChange:           cfg.OnCircuitStateChange,
+	}
+}
+
+// Transport is an http.RoundTripper that applies backpressure to outbound
+// calls. It admits every call through one floodgate.Gate keyed by host and
+// one keyed by route, so calls are shed locally while either is overloaded,
+// with the gates' levels, shedding, concurrency limits, criticality tiers,
+// hooks and tracing. It also runs a circuit breaker per host for upstream
+// failures and refuses calls to a host until the Retry-After of its last 503
+// or 429 has passed.
+//
+// Rejected calls fail with a floodgate.ErrOverloaded error without reaching
+// the network. Calls are recorded under both their host and route keys.
+//
+// Example:
+//
+//	client := &http.Client{
+//	    Transport: bphttp.NewTransport(ctx, bphttp.DefaultTransportConfig()),
+//	}
+type Transport struct {
+	cfg       TransportConfig
+	base      http.RoundTripper
+	hosts     *floodgate.Gate
+	routes    *floodgate.Gate
+	upstreams *expirable.LRU[string, *upstreamState]
+	logger    floodgate.Logger
+	metrics   floodgate.MetricsCollector
+}
+
+// upstreamState holds the circuit breaker and Retry-After deadline of a host,
+// which follow the responses of the host rather than its latency.
+type upstreamState struct {
+	breaker *floodgate.CircuitBreaker
+
+	// retryUntil is when the host's Retry-After passes, in Unix nanoseconds.
+	retryUntil atomic.Int64
+}
+
+// NewTransport creates a client transport. Background work stops when ctx is
+// cancelled.
+func NewTransport(ctx context.Context, cfg TransportConfig) *Transport {
+	base := cfg.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// Use provided logger or default
+	logger := cfg.Logger
+	if logger == nil {
+		logger = floodgate.NewDefaultLogger()
+	}
+
+	// Use provided metrics or no-op
+	metrics := cfg.Metrics
+	if metrics == nil {
+		metrics = &floodgate.NoOpMetrics{}
+	}
+
+	hostCacheSize := cfg.HostCacheSize
+	if hostCacheSize <= 0 {
+		hostCacheSize = cfg.CacheSize
+	}
+
+	t := &Transport{
+		cfg:       cfg,
+		base:      base,
+		hosts:     floodgate.NewGate(ctx, cfg.gateConfig("host", hostCacheSize)),
+		routes:    floodgate.NewGate(ctx, cfg.gateConfig("route", cfg.CacheSize)),
+		upstreams: expirable.NewLRU[string, *upstreamState](hostCacheSize, nil, cfg.CacheTTL),
+		logger:    logger,
+		metrics:   metrics,
+	}
+
+	if cfg.Debug != nil {
+		cfg.Debug.Register("http-client", t.Snapshot)
+	}
+
+	return t
+}
+
+// Snapshot returns the live state of every tracked host and route. A host
+// whose upstream breaker is not closed reports that breaker's state.
+func (t *Transport) Snapshot() floodgate.DebugSnapshot {
+	hosts, routes := t.hosts.Snapshot(), t.routes.Snapshot()
+	for i, key := range hosts.Keys {
+		if upstream, ok := t.upstreams.Peek(key.Key); ok {
+			if state := upstream.breaker.State(); state != floodgate.StateClosed {
+				hosts.Keys[i].CircuitState = state
+			}
+		}
+	}
+
+	snapshot := floodgate.DebugSnapshot{
+		Keys:              append(hosts.Keys, routes.Keys...),
+		DispatcherDropped: hosts.DispatcherDropped + routes.DispatcherDropped,
+		DispatcherTotal:   hosts.DispatcherTotal + routes.DispatcherTotal,
+	}
+	if snapshot.DispatcherTotal > 0 {
+		snapshot.DispatcherDropRate = float64(snapshot.DispatcherDropped) / float64(snapshot.DispatcherTotal) * 100
+	}
+	return snapshot
+}
+
+// upstream returns the upstream state of a host, creating it on first use.
+func (t *Transport) upstream(key string) *upstreamState {
+	state, ok := t.upstreams.Get(key)
+	if !ok {
+		state = &upstreamState{
+			breaker: floodgate.NewCircuitBreaker(
+				t.cfg.CircuitBreakerMaxFailures,
+				t.cfg.CircuitBreakerTimeout,
+				t.cfg.CircuitBreakerSuccessThreshold,
+			),
+		}
+		state.breaker.OnStateChange(func(_, to floodgate.CircuitState) {
+			t.metrics.RecordCircuitBreakerState(key, to)
+		})
+		t.upstreams.Add(key, state)
+	}
+	return state
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	hostKey := req.URL.Host
+	routeKey := req.Method + " " + req.URL.Host + req.URL.Path
+
+	upstream := t.upstream(hostKey)
+	if wait := time.Until(time.Unix(0, upstream.retryUntil.Load())); wait > 0 {
+		return nil, t.reject(ctx, hostKey, routeKey, floodgate.Normal, floodgate.RejectRetryAfter, wait)
+	}
+	if !upstream.breaker.Allow() {
+		t.metrics.RecordCircuitBreakerState(hostKey, upstream.breaker.State())
+		return nil, t.reject(ctx, hostKey, routeKey, floodgate.Emergency, floodgate.RejectCircuitOpen,
+			time.Duration(t.cfg.RetryAfterCircuit)*time.Second)
+	}
+
+	hostDecision, err := t.hosts.Admit(ctx, hostKey)
+	if err != nil {
+		return nil, err
+	}
+	routeDecision, err := t.routes.Admit(ctx, routeKey)
+	if err != nil {
+		hostDecision.Cancel()
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(start)
+
+	outcome := err
+	switch {
+	case err != nil:
+		// A call cancelled by its caller says nothing about the upstream,
+		// but one that ran out of time does
+		if !errors.Is(err, context.Canceled) {
+			upstream.breaker.RecordFailure()
+		}
+
+	case resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests:
+		outcome = errUpstreamStatus
+		upstream.breaker.RecordFailure()
+		if resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests {
+			t.honorRetryAfter(ctx, hostKey, upstream, resp.Header.Get("Retry-After"))
+		}
+
+	default:
+		upstream.breaker.RecordSuccess()
+	}
+
+	hostDecision.Done(latency, outcome)
+	routeDecision.Done(latency, outcome)
+
+	return resp, err
+}
+
+// errUpstreamStatus records a 5xx or 429 response as an error result.
+var errUpstreamStatus = errors.New("upstream responded with an error status")
+
+// reject logs and records a call refused by a host's upstream state.
+func (t *Transport) reject(ctx context.Context, hostKey, routeKey string, level floodgate.Level, rejection floodgate.Rejection, retryAfter time.Duration) error {
+	t.logger.WarnContext(ctx, "outbound call rejected",
+		"host", hostKey,
+		"route", routeKey,
+		"level", level,
+		"rejection", rejection,
+		"retry_after", retryAfter)
+	t.metrics.RecordRequest(ctx, floodgate.RequestLabels{
+		Method:      routeKey,
+		Level:       level,
+		Criticality: floodgate.CriticalityFromContext(ctx),
+		Result:      floodgate.ResultRejected,
+	}, 0, true)
+
+	return floodgate.ErrOverloaded{
+		Key:        hostKey,
+		Level:      level,
+		Rejection:  rejection,
+		RetryAfter: retryAfter,
+	}
+}
+
+// honorRetryAfter refuses calls to host until the Retry-After value has passed.
+func (t *Transport) honorRetryAfter(ctx context.Context, hostKey string, upstream *upstreamState, value string) {
+	wait, err := parseRetryAfter(value, time.Now())
+	if err != nil || wait <= 0 || t.cfg.MaxRetryAfter <= 0 {
+		return
+	}
+	wait = min(wait, t.cfg.MaxRetryAfter)
+
+	upstream.retryUntil.Store(time.Now().Add(wait).UnixNano())
+	t.logger.InfoContext(ctx, "upstream requested retry-after",
+		"host", hostKey,
+		"retry_after", wait)
+}
+
+// parseRetryAfter parses a Retry-After header, given either as seconds or as
+// an HTTP date, into a delay from now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, error) {
+	if value == "" {
+		return 0, errors.New("empty Retry-After")
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, err
+	}
+	return date.Sub(now), nil
+}
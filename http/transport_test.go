@@ -0,0 +1,254 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mushtruk/floodgate"
+)
+
+func testTransportConfig() TransportConfig {
+	cfg := DefaultTransportConfig()
+	cfg.ProbeRatio = 0
+	return cfg
+}
+
+func TestTransport_HonorsRetryAfter(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: NewTransport(context.Background(), testTransportConfig())}
+
+	resp, err := client.Get(upstream.URL + "/api/users")
+	if err != nil {
+		t.Fatalf("Expected first call to reach upstream, got %v", err)
+	}
+	resp.Body.Close()
+
+	_, err = client.Get(upstream.URL + "/api/orders")
+	var overloaded floodgate.ErrOverloaded
+	if !errors.As(err, &overloaded) || overloaded.Rejection != floodgate.RejectRetryAfter {
+		t.Fatalf("Expected retry-after rejection, got %v", err)
+	}
+	if overloaded.RetryAfter <= 59*time.Second || overloaded.RetryAfter > 60*time.Second {
+		t.Errorf("Expected remaining retry-after close to 60s, got %v", overloaded.RetryAfter)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("Expected 1 upstream hit, got %d", hits.Load())
+	}
+}
+
+func TestTransport_ShedsAtCritical(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer upstream.Close()
+
+	cfg := testTransportConfig()
+	cfg.LevelPolicy = floodgate.LevelPolicyFunc(func(floodgate.Stats) (floodgate.Level, floodgate.Reason) {
+		return floodgate.Critical, floodgate.ReasonP95EMACritical
+	})
+	client := &http.Client{Transport: NewTransport(context.Background(), cfg)}
+
+	_, err := client.Get(upstream.URL)
+	var overloaded floodgate.ErrOverloaded
+	if !errors.As(err, &overloaded) || overloaded.Level != floodgate.Critical {
+		t.Fatalf("Expected critical rejection, got %v", err)
+	}
+	if hits.Load() != 0 {
+		t.Errorf("Expected no upstream hits, got %d", hits.Load())
+	}
+}
+
+func TestTransport_ShedsBackgroundCalls(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer upstream.Close()
+
+	var changes atomic.Int32
+	cfg := testTransportConfig()
+	cfg.LevelPolicy = floodgate.LevelPolicyFunc(func(floodgate.Stats) (floodgate.Level, floodgate.Reason) {
+		return floodgate.Moderate, floodgate.ReasonP95Moderate
+	})
+	cfg.OnLevelChange = func(key string, from, to floodgate.Level, stats floodgate.Stats) {
+		changes.Add(1)
+	}
+	client := &http.Client{Transport: NewTransport(context.Background(), cfg)}
+
+	req, err := http.NewRequestWithContext(floodgate.WithCriticality(context.Background(), floodgate.CriticalityBackground), http.MethodGet, upstream.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var overloaded floodgate.ErrOverloaded
+	if _, err := client.Do(req); !errors.As(err, &overloaded) || overloaded.Rejection != floodgate.RejectCriticality {
+		t.Fatalf("Expected background call to be shed, got %v", err)
+	}
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Expected default call to be sent at Moderate, got %v", err)
+	}
+	resp.Body.Close()
+
+	if hits.Load() != 1 {
+		t.Errorf("Expected 1 upstream hit, got %d", hits.Load())
+	}
+	if changes.Load() != 2 {
+		t.Errorf("Expected a level change for the host and the route, got %d", changes.Load())
+	}
+}
+
+func TestTransport_RouteChurnKeepsHostBreaker(t *testing.T) {
+	var hits atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	cfg := testTransportConfig()
+	cfg.CacheSize = 4
+	cfg.CircuitBreakerMaxFailures = 1
+	client := &http.Client{Transport: NewTransport(context.Background(), cfg)}
+
+	// Breakers refuse to open within a second of being created
+	for i := range 2 {
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+		resp, err := client.Get(failing.URL + "/api/users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// Distinct routes of another host fill the route cache many times over
+	for i := range 4 * cfg.CacheSize {
+		resp, err := client.Get(healthy.URL + "/api/" + strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	var overloaded floodgate.ErrOverloaded
+	if _, err := client.Get(failing.URL + "/api/users"); !errors.As(err, &overloaded) || overloaded.Rejection != floodgate.RejectCircuitOpen {
+		t.Fatalf("Expected the host breaker to stay open, got %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("Expected 2 upstream hits, got %d", hits.Load())
+	}
+}
+
+func TestTransport_TimeoutsOpenHostBreaker(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := testTransportConfig()
+	cfg.CircuitBreakerMaxFailures = 1
+	client := &http.Client{Transport: NewTransport(context.Background(), cfg)}
+
+	call := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+"/api/users", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// A call cancelled by its caller is not held against the host
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := call(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected cancelled call, got %v", err)
+	}
+
+	// Breakers refuse to open within a second of being created
+	time.Sleep(time.Second)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := call(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected timed out call, got %v", err)
+	}
+
+	var overloaded floodgate.ErrOverloaded
+	if err := call(context.Background()); !errors.As(err, &overloaded) || overloaded.Rejection != floodgate.RejectCircuitOpen {
+		t.Fatalf("Expected the timeout to open the host breaker, got %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("Expected 2 upstream hits, got %d", hits.Load())
+	}
+}
+
+func TestTransport_Snapshot(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	transport := NewTransport(context.Background(), testTransportConfig())
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(upstream.URL + "/api/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	host := upstream.Listener.Addr().String()
+	keys := map[string]bool{}
+	for _, key := range transport.Snapshot().Keys {
+		keys[key.Key] = true
+	}
+	if !keys[host] || !keys["GET "+host+"/api/users"] {
+		t.Errorf("Expected host and route keys, got %v", keys)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{"120", 2 * time.Minute, false},
+		{"Wed, 01 Jan 2025 12:00:30 GMT", 30 * time.Second, false},
+		{"", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRetryAfter(tt.value, now)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
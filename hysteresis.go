@@ -0,0 +1,99 @@
+package floodgate
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultExitRatio is the fraction of the enter thresholds that stats must
+// fall below before a level de-escalates.
+const DefaultExitRatio = 0.8
+
+// ReasonHysteresis reports that a level was kept because stats have not yet
+// fallen below the exit thresholds or the minimum dwell time has not passed.
+const ReasonHysteresis Reason = "hysteresis"
+
+// Scale returns the thresholds multiplied by ratio, e.g. to derive exit
+// thresholds from enter thresholds.
+func (t Thresholds) Scale(ratio float64) Thresholds {
+	scale := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) * ratio)
+	}
+
+	var quantiles []QuantileThreshold
+	for _, qt := range t.Quantiles {
+		qt.Latency = scale(qt.Latency)
+		quantiles = append(quantiles, qt)
+	}
+	return Thresholds{
+		P99Emergency: scale(t.P99Emergency),
+		P95Critical:  scale(t.P95Critical),
+		EMACritical:  scale(t.EMACritical),
+		P95Moderate:  scale(t.P95Moderate),
+		EMAWarning:   scale(t.EMAWarning),
+		SlopeWarning: scale(t.SlopeWarning),
+		Quantiles:    quantiles,
+		MinSamples:   t.MinSamples,
+	}
+}
+
+// isZero reports whether no threshold is set.
+func (t Thresholds) isZero() bool {
+	return len(t.Quantiles) == 0 && t.MinSamples == 0 && t.P99Emergency == 0 && t.P95Critical == 0 &&
+		t.EMACritical == 0 && t.P95Moderate == 0 && t.EMAWarning == 0 && t.SlopeWarning == 0
+}
+
+// LevelState holds the current level of a single key and applies hysteresis
+// to its transitions, so a key hovering around a threshold does not flap.
+// The zero value starts at Normal. It is safe for concurrent use.
+type LevelState struct {
+	mu    sync.Mutex
+	level Level
+	since time.Time
+}
+
+// Evaluate computes the level for stats. The enter policy escalates the level
+// immediately. De-escalation follows the exit policy, which should use lower
+// thresholds than enter, and only happens once the current level has been
+// held for minDwell. A nil exit policy uses enter for both directions.
+// from is the level before the call; the level changed if from differs from level.
+func (s *LevelState) Evaluate(stats Stats, enter, exit LevelPolicy, minDwell time.Duration) (level Level, reason Reason, from Level) {
+	level, reason = enter.Evaluate(stats)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from = s.level
+	now := time.Now()
+	if level >= from {
+		if level != from {
+			s.level, s.since = level, now
+		}
+		return level, reason, from
+	}
+
+	// De-escalate no further than the exit policy allows
+	target := level
+	if exit != nil {
+		if l, _ := exit.Evaluate(stats); l > target {
+			target = l
+		}
+	}
+
+	if target >= from || now.Sub(s.since) < minDwell {
+		return from, ReasonHysteresis, from
+	}
+
+	s.level, s.since = target, now
+	if target != level {
+		reason = ReasonHysteresis
+	}
+	return target, reason, from
+}
+
+// Level returns the current level.
+func (s *LevelState) Level() Level {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.level
+}
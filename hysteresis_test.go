@@ -0,0 +1,55 @@
+package floodgate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLevelState_Hysteresis(t *testing.T) {
+	thresholds := DefaultThresholds()
+	enter := ThresholdPolicy{Thresholds: thresholds}
+	exit := ThresholdPolicy{Thresholds: thresholds.Scale(DefaultExitRatio)}
+
+	var state LevelState
+
+	moderate := Stats{EMA: 100 * time.Millisecond, P95: 1200 * time.Millisecond, P99: 1500 * time.Millisecond}
+	level, reason, from := state.Evaluate(moderate, enter, exit, 0)
+	if level != Moderate || reason != ReasonP95Moderate || from != Normal {
+		t.Fatalf("Expected immediate escalation to moderate, got %v (%s) from %v", level, reason, from)
+	}
+
+	// Just below the enter threshold but above the exit threshold
+	hovering := Stats{EMA: 100 * time.Millisecond, P95: 900 * time.Millisecond, P99: 1000 * time.Millisecond}
+	level, reason, from = state.Evaluate(hovering, enter, exit, 0)
+	if level != Moderate || reason != ReasonHysteresis || from != Moderate {
+		t.Errorf("Expected moderate to be held, got %v (%s) from %v", level, reason, from)
+	}
+
+	calm := Stats{EMA: 100 * time.Millisecond, P95: 200 * time.Millisecond, P99: 300 * time.Millisecond}
+	level, reason, from = state.Evaluate(calm, enter, exit, 0)
+	if level != Normal || reason != ReasonWithinThresholds || from != Moderate {
+		t.Errorf("Expected de-escalation to normal, got %v (%s) from %v", level, reason, from)
+	}
+}
+
+func TestLevelState_MinDwell(t *testing.T) {
+	policy := ThresholdPolicy{Thresholds: DefaultThresholds()}
+	critical := Stats{EMA: time.Second, P95: 3 * time.Second, P99: 4 * time.Second}
+	calm := Stats{EMA: 100 * time.Millisecond, P95: 200 * time.Millisecond, P99: 300 * time.Millisecond}
+
+	var state LevelState
+	state.Evaluate(critical, policy, nil, 20*time.Millisecond)
+
+	if level, _, _ := state.Evaluate(calm, policy, nil, 20*time.Millisecond); level != Critical {
+		t.Errorf("Expected critical within dwell time, got %v", level)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if level, _, from := state.Evaluate(calm, policy, nil, 20*time.Millisecond); level != Normal || from != Critical {
+		t.Errorf("Expected normal after dwell time, got %v", level)
+	}
+	if state.Level() != Normal {
+		t.Errorf("Expected stored level normal, got %v", state.Level())
+	}
+}
@@ -28,13 +28,75 @@ func (b Level) String() string {
 	}
 }
 
-// Level calculates backpressure level using default thresholds.
-func (stats Stats) Level() Level {
-	return stats.LevelWithThresholds(DefaultThresholds())
+// Reason is a machine-readable explanation of why a level was chosen.
+type Reason string
+
+// Reasons reported by ThresholdPolicy.
+const (
+	ReasonWithinThresholds      Reason = "within_thresholds"
+	ReasonP99Emergency          Reason = "p99_emergency"
+	ReasonP95EMACritical        Reason = "p95_ema_critical"
+	ReasonP95Moderate           Reason = "p95_moderate"
+	ReasonEMAWarning            Reason = "ema_warning"
+	ReasonSlopeWarning          Reason = "slope_warning"
+	ReasonSlopeFallbackCritical Reason = "slope_fallback_critical"
+	ReasonSlopeFallbackModerate Reason = "slope_fallback_moderate"
+	ReasonSlopeFallbackWarning  Reason = "slope_fallback_warning"
+	ReasonQuantileThreshold     Reason = "quantile_threshold"
+	ReasonInsufficientSamples   Reason = "insufficient_samples"
+)
+
+// LevelPolicy decides the backpressure level for a key from its stats.
+// Implementations must be safe for concurrent use.
+type LevelPolicy interface {
+	// Evaluate returns the level for stats and the reason it was chosen.
+	Evaluate(stats Stats) (Level, Reason)
 }
 
-// LevelWithThresholds calculates backpressure level using custom thresholds.
-func (stats Stats) LevelWithThresholds(thresholds Thresholds) Level {
+// LevelPolicyFunc adapts an ordinary function to a LevelPolicy.
+type LevelPolicyFunc func(stats Stats) (Level, Reason)
+
+// Evaluate implements LevelPolicy.
+func (f LevelPolicyFunc) Evaluate(stats Stats) (Level, Reason) {
+	return f(stats)
+}
+
+// ThresholdPolicy is the default LevelPolicy. It combines percentiles, EMA and
+// slope against fixed thresholds:
+//
+//	Emergency: P99 > P99Emergency
+//	Critical:  P95 > P95Critical AND EMA > EMACritical
+//	Moderate:  P95 > P95Moderate
+//	Warning:   EMA > EMAWarning OR Slope > SlopeWarning
+//
+// When percentiles are unavailable it falls back to slope alone, comparing
+// against 5/10, 3/10 and 1/10 of SlopeWarning for Critical, Moderate and Warning.
+//
+// Thresholds.Quantiles are checked as well, and win if they give a more
+// severe level. Stats with fewer than Thresholds.MinSamples samples are
+// always Normal.
+type ThresholdPolicy struct {
+	Thresholds Thresholds
+}
+
+// Evaluate implements LevelPolicy.
+func (p ThresholdPolicy) Evaluate(stats Stats) (Level, Reason) {
+	if stats.Count < p.Thresholds.MinSamples {
+		return Normal, ReasonInsufficientSamples
+	}
+
+	level, reason := p.evaluate(stats)
+	for _, qt := range p.Thresholds.Quantiles {
+		if v := stats.Quantile(qt.Quantile); v > 0 && v > qt.Latency && qt.Level > level {
+			level, reason = qt.Level, ReasonQuantileThreshold
+		}
+	}
+	return level, reason
+}
+
+// evaluate applies the fixed thresholds.
+func (p ThresholdPolicy) evaluate(stats Stats) (Level, Reason) {
+	thresholds := p.Thresholds
 	ema := stats.EMA
 	slope := stats.Slope
 
@@ -42,25 +104,54 @@ func (stats Stats) LevelWithThresholds(thresholds Thresholds) Level {
 	if stats.P95 > 0 && stats.P99 > 0 {
 		switch {
 		case stats.P99 > thresholds.P99Emergency:
-			return Emergency
+			return Emergency, ReasonP99Emergency
 		case stats.P95 > thresholds.P95Critical && ema > thresholds.EMACritical:
-			return Critical
+			return Critical, ReasonP95EMACritical
 		case stats.P95 > thresholds.P95Moderate:
-			return Moderate
-		case ema > thresholds.EMAWarning || slope > thresholds.SlopeWarning:
-			return Warning
+			return Moderate, ReasonP95Moderate
+		case ema > thresholds.EMAWarning:
+			return Warning, ReasonEMAWarning
+		case slope > thresholds.SlopeWarning:
+			return Warning, ReasonSlopeWarning
 		}
 	} else {
 		// Fallback to slope-based detection
 		switch {
 		case slope > 5*thresholds.SlopeWarning/10:
-			return Critical
+			return Critical, ReasonSlopeFallbackCritical
 		case slope > 3*thresholds.SlopeWarning/10:
-			return Moderate
+			return Moderate, ReasonSlopeFallbackModerate
 		case slope > thresholds.SlopeWarning/10:
-			return Warning
+			return Warning, ReasonSlopeFallbackWarning
 		}
 	}
 
-	return Normal
+	return Normal, ReasonWithinThresholds
+}
+
+// CompositePolicy evaluates several policies and returns the most severe level.
+// Ties keep the reason of the earliest policy.
+type CompositePolicy []LevelPolicy
+
+// Evaluate implements LevelPolicy.
+func (c CompositePolicy) Evaluate(stats Stats) (Level, Reason) {
+	level, reason := Normal, ReasonWithinThresholds
+	for _, policy := range c {
+		if l, r := policy.Evaluate(stats); l > level {
+			level, reason = l, r
+		}
+	}
+	return level, reason
+}
+
+// Level calculates backpressure level using default thresholds.
+func (stats Stats) Level() Level {
+	return stats.LevelWithThresholds(DefaultThresholds())
+}
+
+// LevelWithThresholds calculates backpressure level using custom thresholds.
+// It is shorthand for ThresholdPolicy{Thresholds: thresholds}.Evaluate(stats).
+func (stats Stats) LevelWithThresholds(thresholds Thresholds) Level {
+	level, _ := ThresholdPolicy{Thresholds: thresholds}.Evaluate(stats)
+	return level
 }
@@ -0,0 +1,268 @@
+package floodgate
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// LimitSample describes a completed request for a LimitAlgorithm.
+type LimitSample struct {
+	// RTT is the latency of the completed request.
+	RTT time.Duration
+
+	// NoLoadRTT is the estimated latency with no queueing: the minimum RTT
+	// observed by the limiter over its recent sampling window.
+	NoLoadRTT time.Duration
+
+	// InFlight is the number of requests in flight when the request started.
+	InFlight int
+
+	// Dropped reports that the request timed out or was abandoned,
+	// which algorithms treat as a strong overload signal.
+	Dropped bool
+}
+
+// LimitAlgorithm adjusts a concurrency limit from completed requests.
+// Algorithms may keep state, so every Limiter needs its own instance.
+type LimitAlgorithm interface {
+	// Update returns the new limit given the current limit and a sample.
+	Update(limit float64, sample LimitSample) float64
+}
+
+// Limiter bounds the number of in-flight requests for a single key and adapts
+// the bound with a LimitAlgorithm, in the style of Netflix's concurrency-limits.
+// It is safe for concurrent use.
+type Limiter struct {
+	mu sync.Mutex
+
+	algorithm LimitAlgorithm
+	limit     float64
+	minLimit  float64
+	maxLimit  float64
+	inFlight  int
+
+	// noLoadRTT is the minimum RTT seen in the current window of samples.
+	noLoadRTT   time.Duration
+	windowCount int
+}
+
+// minRTTWindow is the number of samples after which the no-load RTT estimate restarts.
+const minRTTWindow = 1000
+
+// NewLimiter creates a limiter starting at initialLimit and kept within
+// [minLimit, maxLimit]. minLimit is clamped to at least 1.
+func NewLimiter(algorithm LimitAlgorithm, initialLimit, minLimit, maxLimit int) *Limiter {
+	if minLimit < 1 {
+		minLimit = 1
+	}
+	if maxLimit < minLimit {
+		maxLimit = minLimit
+	}
+	initialLimit = min(max(initialLimit, minLimit), maxLimit)
+
+	return &Limiter{
+		algorithm: algorithm,
+		limit:     float64(initialLimit),
+		minLimit:  float64(minLimit),
+		maxLimit:  float64(maxLimit),
+	}
+}
+
+// Acquire reserves a slot for a request. It returns false if the key is at its
+// concurrency limit, in which case Release must not be called.
+func (l *Limiter) Acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// Release returns a slot reserved by Acquire and feeds the request's latency to
+// the limit algorithm. It reports the resulting limit and whether it changed.
+func (l *Limiter) Release(rtt time.Duration, dropped bool) (limit int, changed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+
+	l.windowCount++
+	if l.windowCount >= minRTTWindow {
+		// Restart the estimate so it can follow a permanent latency shift
+		l.windowCount = 0
+		l.noLoadRTT = rtt
+	} else if l.noLoadRTT == 0 || rtt < l.noLoadRTT {
+		l.noLoadRTT = rtt
+	}
+
+	previous := int(l.limit)
+	next := l.algorithm.Update(l.limit, LimitSample{
+		RTT:       rtt,
+		NoLoadRTT: l.noLoadRTT,
+		InFlight:  inFlight,
+		Dropped:   dropped,
+	})
+	l.limit = min(max(next, l.minLimit), l.maxLimit)
+
+	return int(l.limit), int(l.limit) != previous
+}
+
+// Cancel returns a slot reserved by Acquire for a request that never ran,
+// without feeding the limit algorithm.
+func (l *Limiter) Cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+}
+
+// Limit returns the current concurrency limit.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of requests currently holding a slot.
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// AIMDLimit grows the limit by one while the limit is in use and cuts it
+// multiplicatively when a request is dropped or exceeds Timeout.
+type AIMDLimit struct {
+	// BackoffRatio multiplies the limit on overload. Zero uses 0.9.
+	BackoffRatio float64
+
+	// Timeout marks slower requests as dropped. Zero disables it.
+	Timeout time.Duration
+}
+
+// Update implements LimitAlgorithm.
+func (a AIMDLimit) Update(limit float64, sample LimitSample) float64 {
+	backoff := a.BackoffRatio
+	if backoff <= 0 || backoff >= 1 {
+		backoff = 0.9
+	}
+
+	if sample.Dropped || (a.Timeout > 0 && sample.RTT > a.Timeout) {
+		return limit * backoff
+	}
+
+	// Only grow when the limit is actually being used
+	if float64(sample.InFlight)*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// VegasLimit estimates the queue size from the ratio of the no-load RTT to the
+// sampled RTT, as in TCP Vegas. It grows the limit while the estimated queue is
+// short and shrinks it once the queue grows past a threshold that scales with
+// log10(limit).
+type VegasLimit struct{}
+
+// Update implements LimitAlgorithm.
+func (VegasLimit) Update(limit float64, sample LimitSample) float64 {
+	step := max(1, math.Log10(limit))
+
+	if sample.Dropped {
+		return limit - step
+	}
+	if sample.RTT <= 0 || sample.NoLoadRTT <= 0 {
+		return limit
+	}
+
+	// Do not grow while the limit is not being used
+	if float64(sample.InFlight)*2 < limit {
+		return limit
+	}
+
+	queue := math.Ceil(limit * (1 - float64(sample.NoLoadRTT)/float64(sample.RTT)))
+	alpha := 3 * step
+	beta := 6 * step
+
+	switch {
+	case queue <= step:
+		return limit + beta
+	case queue < alpha:
+		return limit + step
+	case queue > beta:
+		return limit - step
+	default:
+		return limit
+	}
+}
+
+// Gradient2Limit compares a short-term RTT against a long-term RTT average and
+// scales the limit by their ratio, as in Netflix's Gradient2 algorithm. It is
+// stateful; create one per Limiter with NewGradient2Limit.
+type Gradient2Limit struct {
+	// Tolerance is how much the short-term RTT may exceed the long-term
+	// average before the limit shrinks. Zero uses 1.5.
+	Tolerance float64
+
+	// Smoothing weights each new limit estimate. Zero uses 0.2.
+	Smoothing float64
+
+	// LongWindow is the number of samples in the long-term RTT average.
+	// Zero uses 600.
+	LongWindow int
+
+	longRTT float64
+}
+
+// NewGradient2Limit creates a Gradient2Limit with default parameters.
+func NewGradient2Limit() *Gradient2Limit {
+	return &Gradient2Limit{
+		Tolerance:  1.5,
+		Smoothing:  0.2,
+		LongWindow: 600,
+	}
+}
+
+// Update implements LimitAlgorithm.
+func (g *Gradient2Limit) Update(limit float64, sample LimitSample) float64 {
+	tolerance, smoothing, window := g.Tolerance, g.Smoothing, g.LongWindow
+	if tolerance <= 0 {
+		tolerance = 1.5
+	}
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+	if window <= 0 {
+		window = 600
+	}
+
+	shortRTT := float64(sample.RTT)
+	if shortRTT <= 0 {
+		return limit
+	}
+
+	if g.longRTT == 0 {
+		g.longRTT = shortRTT
+	} else {
+		g.longRTT += (shortRTT - g.longRTT) * 2 / float64(window+1)
+	}
+
+	// Let the long-term average catch up after a sustained latency drop
+	if g.longRTT/shortRTT > 2 {
+		g.longRTT *= 0.95
+	}
+
+	// Do not grow while the limit is not being used
+	if float64(sample.InFlight) < limit/2 {
+		return limit
+	}
+
+	gradient := max(0.5, min(1.0, tolerance*g.longRTT/shortRTT))
+	next := limit*gradient + math.Sqrt(limit)
+
+	return limit*(1-smoothing) + next*smoothing
+}
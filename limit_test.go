@@ -0,0 +1,74 @@
+package floodgate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_AcquireRelease(t *testing.T) {
+	limiter := NewLimiter(AIMDLimit{}, 2, 1, 10)
+
+	if !limiter.Acquire() || !limiter.Acquire() {
+		t.Fatal("Expected two slots to be available")
+	}
+	if limiter.Acquire() {
+		t.Fatal("Expected acquire to fail at the limit")
+	}
+
+	// Both slots in use, so AIMD grows the limit
+	if limit, changed := limiter.Release(10*time.Millisecond, false); limit != 3 || !changed {
+		t.Fatalf("Expected limit to grow to 3, got %d (changed=%v)", limit, changed)
+	}
+	if got := limiter.InFlight(); got != 1 {
+		t.Fatalf("Expected 1 in flight, got %d", got)
+	}
+}
+
+func TestLimiter_ClampsToBounds(t *testing.T) {
+	limiter := NewLimiter(AIMDLimit{BackoffRatio: 0.1}, 5, 2, 10)
+
+	limiter.Acquire()
+	if limit, _ := limiter.Release(time.Second, true); limit != 2 {
+		t.Fatalf("Expected limit clamped to minimum 2, got %d", limit)
+	}
+}
+
+func TestLimitAlgorithms_BackOffUnderQueueing(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm LimitAlgorithm
+	}{
+		{"AIMD", AIMDLimit{Timeout: 50 * time.Millisecond}},
+		{"Vegas", VegasLimit{}},
+		{"Gradient2", NewGradient2Limit()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := 100.0
+
+			// Establish a fast baseline
+			for i := 0; i < 50; i++ {
+				limit = tt.algorithm.Update(limit, LimitSample{
+					RTT:       10 * time.Millisecond,
+					NoLoadRTT: 10 * time.Millisecond,
+					InFlight:  int(limit),
+				})
+			}
+			baseline := limit
+
+			// Latency rises tenfold as requests queue up
+			for i := 0; i < 50; i++ {
+				limit = tt.algorithm.Update(limit, LimitSample{
+					RTT:       100 * time.Millisecond,
+					NoLoadRTT: 10 * time.Millisecond,
+					InFlight:  int(limit),
+				})
+			}
+
+			if limit >= baseline {
+				t.Errorf("Expected limit to shrink below %.1f, got %.1f", baseline, limit)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package floodgate
 
 import (
 	"context"
+	"strconv"
 	"time"
 )
 
@@ -31,6 +32,11 @@ import (
 // - Circuit breaker state transitions
 // - Cache utilization (active trackers)
 // - Dispatcher performance (async processing drops)
+//
+// Tracked latency stats and adaptive concurrency limits are recorded by
+// collectors that also implement StatsMetricsCollector and
+// ConcurrencyMetricsCollector; EvictionMetricsCollector lets them drop the
+// series of evicted keys.
 type MetricsCollector interface {
 	// RecordRequest records a completed request with its outcome.
 	// This is called for every request processed by the middleware.
@@ -84,6 +90,60 @@ type MetricsCollector interface {
 	RecordDispatcherStats(dropped, total uint64)
 }
 
+// StatsMetricsCollector is an optional extension of MetricsCollector for
+// tracked latency stats. Collectors that do not implement it keep working;
+// stats are then not recorded.
+type StatsMetricsCollector interface {
+	// RecordStats records the tracked latency stats of a method/route.
+	// Called periodically (if metrics are enabled) for every active tracker.
+	//
+	// Parameters:
+	//   method: gRPC method or HTTP route
+	//   stats: current stats, including every quantile in stats.Quantiles
+	//
+	// Implementations should:
+	// - Update a gauge per quantile, labelled with QuantileLabel
+	RecordStats(method string, stats Stats)
+}
+
+// ConcurrencyMetricsCollector is an optional extension of MetricsCollector for
+// adaptive concurrency limits. Collectors that do not implement it keep
+// working; limits are then not recorded.
+type ConcurrencyMetricsCollector interface {
+	// RecordConcurrencyLimit records the adaptive concurrency limit of a method/route.
+	// Called when a ConcurrencyLimiter changes its limit.
+	//
+	// Parameters:
+	//   method: gRPC method or HTTP route
+	//   limit: current concurrency limit
+	//   inFlight: requests currently in flight
+	//
+	// Implementations should:
+	// - Update gauge metrics for the limit and in-flight requests
+	// - Alert when in-flight requests sit at the limit
+	RecordConcurrencyLimit(method string, limit, inFlight int)
+}
+
+// EvictionMetricsCollector is an optional extension of MetricsCollector for
+// collectors that keep a series per method/route. Collectors that do not
+// implement it keep working; their series then outlive evicted keys.
+type EvictionMetricsCollector interface {
+	// RecordEviction records that a method/route was evicted from the tracker
+	// cache, after CacheTTL or to make room for others.
+	//
+	// Parameters:
+	//   method: gRPC method or HTTP route
+	//
+	// Implementations should:
+	// - Delete the method's gauges, so they stop reporting its last values
+	RecordEviction(method string)
+}
+
+// QuantileLabel formats q for a metric label, e.g. "0.999".
+func QuantileLabel(q float64) string {
+	return strconv.FormatFloat(q, 'f', -1, 64)
+}
+
 // RequestLabels contains structured labels for request metrics.
 // Using a struct provides type safety and makes it easy to add new labels.
 type RequestLabels struct {
@@ -95,11 +155,52 @@ type RequestLabels struct {
 	// Values: Normal, Warning, Moderate, Critical, Emergency
 	Level Level
 
+	// Criticality is the request tier.
+	// Values: CriticalityDefault, CriticalityCritical, CriticalitySheddable, CriticalityBackground
+	Criticality Criticality
+
 	// Result indicates the request outcome.
-	// Values: "success" (request accepted), "rejected" (backpressure rejection)
+	// Values: ResultSuccess, ResultError, ResultRejected, ResultShed, ResultProbe,
+	// ResultLimited, ResultDeadline, ResultDegraded, ResultWouldReject
 	Result string
 }
 
+// Request outcomes reported in RequestLabels.Result.
+const (
+	// ResultSuccess is a request that was admitted and completed.
+	ResultSuccess = "success"
+
+	// ResultError is a request that was admitted and returned an error.
+	ResultError = "error"
+
+	// ResultRejected is a request rejected by the circuit breaker or by
+	// level-based backpressure.
+	ResultRejected = "rejected"
+
+	// ResultShed is a request rejected probabilistically by a ShedPolicy.
+	ResultShed = "shed"
+
+	// ResultProbe is a request admitted as a recovery probe while its key
+	// was at a rejecting level.
+	ResultProbe = "probe"
+
+	// ResultLimited is a request rejected by the adaptive concurrency limiter.
+	ResultLimited = "limited"
+
+	// ResultDeadline is a request rejected because its deadline was too
+	// short for it to finish.
+	ResultDeadline = "deadline"
+
+	// ResultDegraded is a request admitted in brownout mode at a level
+	// that would otherwise reject it.
+	ResultDegraded = "degraded"
+
+	// ResultWouldReject is a request that would have been rejected but was
+	// let through in shadow mode. It is recorded in addition to the
+	// request's outcome.
+	ResultWouldReject = "would_reject"
+)
+
 // NoOpMetrics is a metrics collector that discards all metrics.
 // Use this to completely disable metrics collection in production if desired.
 //
@@ -119,3 +220,12 @@ func (NoOpMetrics) RecordCacheSize(size int) {}
 
 // RecordDispatcherStats implements MetricsCollector.
 func (NoOpMetrics) RecordDispatcherStats(dropped, total uint64) {}
+
+// RecordConcurrencyLimit implements ConcurrencyMetricsCollector.
+func (NoOpMetrics) RecordConcurrencyLimit(method string, limit, inFlight int) {}
+
+// RecordStats implements StatsMetricsCollector.
+func (NoOpMetrics) RecordStats(method string, stats Stats) {}
+
+// RecordEviction implements EvictionMetricsCollector.
+func (NoOpMetrics) RecordEviction(method string) {}
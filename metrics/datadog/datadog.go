@@ -106,6 +106,7 @@ func (m *Metrics) RecordRequest(ctx context.Context, labels floodgate.RequestLab
 	tags := []string{
 		fmt.Sprintf("method:%s", labels.Method),
 		fmt.Sprintf("level:%s", labels.Level),
+		fmt.Sprintf("criticality:%s", labels.Criticality),
 		fmt.Sprintf("result:%s", labels.Result),
 	}
 	tags = m.mergeTags(tags)
@@ -118,6 +119,7 @@ func (m *Metrics) RecordRequest(ctx context.Context, labels floodgate.RequestLab
 		rejectTags := []string{
 			fmt.Sprintf("method:%s", labels.Method),
 			fmt.Sprintf("level:%s", labels.Level),
+			fmt.Sprintf("criticality:%s", labels.Criticality),
 		}
 		rejectTags = m.mergeTags(rejectTags)
 		_ = m.client.Incr(m.metricName("requests.rejected"), rejectTags, 1.0)
@@ -186,3 +188,24 @@ func (m *Metrics) RecordDispatcherStats(dropped, total uint64) {
 	m.lastDropped = dropped
 	m.lastTotal = total
 }
+
+// RecordConcurrencyLimit implements floodgate.ConcurrencyMetricsCollector.
+func (m *Metrics) RecordConcurrencyLimit(method string, limit, inFlight int) {
+	tags := m.mergeTags([]string{
+		fmt.Sprintf("method:%s", method),
+	})
+
+	_ = m.client.Gauge(m.metricName("concurrency.limit"), float64(limit), tags, 1.0)
+	_ = m.client.Gauge(m.metricName("concurrency.in_flight"), float64(inFlight), tags, 1.0)
+}
+
+// RecordStats implements floodgate.StatsMetricsCollector.
+func (m *Metrics) RecordStats(method string, stats floodgate.Stats) {
+	for _, qv := range stats.Quantiles {
+		tags := m.mergeTags([]string{
+			fmt.Sprintf("method:%s", method),
+			fmt.Sprintf("quantile:%s", floodgate.QuantileLabel(qv.Quantile)),
+		})
+		_ = m.client.Gauge(m.metricName("latency.quantile"), qv.Value.Seconds(), tags, 1.0)
+	}
+}
@@ -8,4 +8,6 @@ require (
 	go.opentelemetry.io/otel/metric v1.33.0
 )
 
+require github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+
 replace github.com/mushtruk/floodgate => ../..
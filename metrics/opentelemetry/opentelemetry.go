@@ -39,6 +39,9 @@ type Metrics struct {
 	cacheSize        metric.Int64Gauge
 	dispatcherDrops  metric.Int64Counter
 	dispatcherTotal  metric.Int64Counter
+	concurrencyLimit metric.Int64Gauge
+	inFlight         metric.Int64Gauge
+	latencyQuantile  metric.Float64Gauge
 
 	// Track previous values for delta calculation
 	lastDropped uint64
@@ -115,6 +118,33 @@ func NewMetrics(meter metric.Meter) (*Metrics, error) {
 		return nil, err
 	}
 
+	concurrencyLimit, err := meter.Int64Gauge(
+		"floodgate.concurrency.limit",
+		metric.WithDescription("Adaptive concurrency limit by method"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	inFlight, err := meter.Int64Gauge(
+		"floodgate.concurrency.in_flight",
+		metric.WithDescription("Requests in flight under the adaptive concurrency limit by method"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	latencyQuantile, err := meter.Float64Gauge(
+		"floodgate.latency.quantile",
+		metric.WithDescription("Tracked latency quantiles by method and quantile"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Metrics{
 		requestsTotal:    requestsTotal,
 		requestsRejected: requestsRejected,
@@ -123,6 +153,9 @@ func NewMetrics(meter metric.Meter) (*Metrics, error) {
 		cacheSize:        cacheSize,
 		dispatcherDrops:  dispatcherDrops,
 		dispatcherTotal:  dispatcherTotal,
+		concurrencyLimit: concurrencyLimit,
+		inFlight:         inFlight,
+		latencyQuantile:  latencyQuantile,
 	}, nil
 }
 
@@ -131,6 +164,7 @@ func (m *Metrics) RecordRequest(ctx context.Context, labels floodgate.RequestLab
 	attrs := []attribute.KeyValue{
 		attribute.String("method", labels.Method),
 		attribute.String("level", labels.Level.String()),
+		attribute.String("criticality", labels.Criticality.String()),
 		attribute.String("result", labels.Result),
 	}
 
@@ -142,6 +176,7 @@ func (m *Metrics) RecordRequest(ctx context.Context, labels floodgate.RequestLab
 		rejectAttrs := []attribute.KeyValue{
 			attribute.String("method", labels.Method),
 			attribute.String("level", labels.Level.String()),
+			attribute.String("criticality", labels.Criticality.String()),
 		}
 		m.requestsRejected.Add(ctx, 1, metric.WithAttributes(rejectAttrs...))
 	}
@@ -195,3 +230,24 @@ func (m *Metrics) RecordDispatcherStats(dropped, total uint64) {
 	m.lastDropped = dropped
 	m.lastTotal = total
 }
+
+// RecordConcurrencyLimit implements floodgate.ConcurrencyMetricsCollector.
+func (m *Metrics) RecordConcurrencyLimit(method string, limit, inFlight int) {
+	ctx := context.Background()
+	attrs := metric.WithAttributes(attribute.String("method", method))
+
+	m.concurrencyLimit.Record(ctx, int64(limit), attrs)
+	m.inFlight.Record(ctx, int64(inFlight), attrs)
+}
+
+// RecordStats implements floodgate.StatsMetricsCollector.
+func (m *Metrics) RecordStats(method string, stats floodgate.Stats) {
+	ctx := context.Background()
+	for _, qv := range stats.Quantiles {
+		attrs := metric.WithAttributes(
+			attribute.String("method", method),
+			attribute.String("quantile", floodgate.QuantileLabel(qv.Quantile)),
+		)
+		m.latencyQuantile.Record(ctx, qv.Value.Seconds(), attrs)
+	}
+}
@@ -33,6 +33,9 @@ type Metrics struct {
 	cacheSize        prometheus.Gauge
 	dispatcherDrops  prometheus.Counter
 	dispatcherTotal  prometheus.Counter
+	concurrencyLimit *prometheus.GaugeVec
+	inFlight         *prometheus.GaugeVec
+	latencyQuantile  *prometheus.GaugeVec
 
 	// Track previous values for delta calculation
 	lastDropped uint64
@@ -51,17 +54,17 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 			prometheus.CounterOpts{
 				Namespace: "floodgate",
 				Name:      "requests_total",
-				Help:      "Total number of requests processed by method, level, and result",
+				Help:      "Total number of requests processed by method, level, criticality, and result",
 			},
-			[]string{"method", "level", "result"},
+			[]string{"method", "level", "criticality", "result"},
 		),
 		requestsRejected: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: "floodgate",
 				Name:      "requests_rejected_total",
-				Help:      "Total number of requests rejected due to backpressure by method and level",
+				Help:      "Total number of requests rejected due to backpressure by method, level, and criticality",
 			},
-			[]string{"method", "level"},
+			[]string{"method", "level", "criticality"},
 		),
 		latencyHistogram: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
@@ -102,6 +105,30 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 				Help:      "Total number of events emitted to async dispatcher",
 			},
 		),
+		concurrencyLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "floodgate",
+				Name:      "concurrency_limit",
+				Help:      "Adaptive concurrency limit by method",
+			},
+			[]string{"method"},
+		),
+		inFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "floodgate",
+				Name:      "concurrency_in_flight",
+				Help:      "Requests in flight under the adaptive concurrency limit by method",
+			},
+			[]string{"method"},
+		),
+		latencyQuantile: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "floodgate",
+				Name:      "latency_quantile_seconds",
+				Help:      "Tracked latency quantiles in seconds by method and quantile",
+			},
+			[]string{"method", "quantile"},
+		),
 	}
 
 	// Register all metrics
@@ -113,6 +140,9 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 		m.cacheSize,
 		m.dispatcherDrops,
 		m.dispatcherTotal,
+		m.concurrencyLimit,
+		m.inFlight,
+		m.latencyQuantile,
 	)
 
 	return m
@@ -121,11 +151,11 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 // RecordRequest implements floodgate.MetricsCollector.
 func (m *Metrics) RecordRequest(ctx context.Context, labels floodgate.RequestLabels, latency time.Duration, rejected bool) {
 	// Increment total requests
-	m.requestsTotal.WithLabelValues(labels.Method, labels.Level.String(), labels.Result).Inc()
+	m.requestsTotal.WithLabelValues(labels.Method, labels.Level.String(), labels.Criticality.String(), labels.Result).Inc()
 
 	// Track rejections separately for easier alerting
 	if rejected {
-		m.requestsRejected.WithLabelValues(labels.Method, labels.Level.String()).Inc()
+		m.requestsRejected.WithLabelValues(labels.Method, labels.Level.String(), labels.Criticality.String()).Inc()
 	}
 
 	// Record latency distribution
@@ -168,3 +198,25 @@ func (m *Metrics) RecordDispatcherStats(dropped, total uint64) {
 	m.lastDropped = dropped
 	m.lastTotal = total
 }
+
+// RecordConcurrencyLimit implements floodgate.ConcurrencyMetricsCollector.
+func (m *Metrics) RecordConcurrencyLimit(method string, limit, inFlight int) {
+	m.concurrencyLimit.WithLabelValues(method).Set(float64(limit))
+	m.inFlight.WithLabelValues(method).Set(float64(inFlight))
+}
+
+// RecordStats implements floodgate.StatsMetricsCollector.
+func (m *Metrics) RecordStats(method string, stats floodgate.Stats) {
+	for _, qv := range stats.Quantiles {
+		m.latencyQuantile.WithLabelValues(method, floodgate.QuantileLabel(qv.Quantile)).Set(qv.Value.Seconds())
+	}
+}
+
+// RecordEviction implements floodgate.EvictionMetricsCollector. It deletes the
+// gauges of method; its counters and histograms are cumulative and stay.
+func (m *Metrics) RecordEviction(method string) {
+	m.circuitBreaker.DeleteLabelValues(method)
+	m.concurrencyLimit.DeleteLabelValues(method)
+	m.inFlight.DeleteLabelValues(method)
+	m.latencyQuantile.DeletePartialMatch(prometheus.Labels{"method": method})
+}
@@ -1,5 +1,7 @@
 package floodgate
 
+import "time"
+
 // Option configures a latency tracker.
 type Option func(*emaTracker)
 
@@ -35,6 +37,9 @@ func WithWindowSize(size int) Option {
 
 // WithPercentiles enables percentile tracking with the specified sample buffer size.
 // Values less than 10 are clamped to 10 (minimum for meaningful percentiles).
+// Percentiles are exact over the last sampleSize samples unless
+// WithQuantileEstimator is also given, and are recalculated every tenth of
+// sampleSize samples.
 func WithPercentiles(sampleSize int) Option {
 	if sampleSize < 10 {
 		sampleSize = 10
@@ -42,7 +47,54 @@ func WithPercentiles(sampleSize int) Option {
 	return func(t *emaTracker) {
 		t.percentileEnabled = true
 		t.sampleSize = sampleSize
-		t.samples = make([]int64, 0, sampleSize)
-		t.sortBuffer = make([]int64, sampleSize)
+	}
+}
+
+// WithQuantiles enables percentile tracking and tracks quantiles in addition
+// to P50, P95 and P99, e.g. 0.9 and 0.999, or 1 for the maximum. They are
+// read with Stats.Quantile and can be used in Thresholds.Quantiles.
+// Quantiles are clamped to [0, 1].
+func WithQuantiles(quantiles ...float64) Option {
+	return func(t *emaTracker) {
+		t.percentileEnabled = true
+		t.quantileList = mergeQuantiles(t.quantileList, quantiles)
+	}
+}
+
+// WithQuantileEstimator enables percentile tracking backed by estimator,
+// such as NewDDSketch or NewTDigest, instead of sorting a sample buffer.
+// Each tracker needs its own estimator.
+func WithQuantileEstimator(estimator QuantileEstimator) Option {
+	return func(t *emaTracker) {
+		if estimator != nil {
+			t.percentileEnabled = true
+			t.quantiles = estimator
+		}
+	}
+}
+
+// WithDecay makes stats decay when no samples arrive, so that a key whose
+// requests are all being rejected does not stay frozen at its last values.
+// Once no sample has arrived for one half-life, EMA, trend and percentiles
+// halve every halfLife. Zero or negative values disable decay.
+func WithDecay(halfLife time.Duration) Option {
+	return func(t *emaTracker) {
+		t.decayHalfLife = halfLife
+	}
+}
+
+// WithTimeWindow makes percentiles, slope and drift describe the samples of
+// the last window rather than the last N samples, whatever the request rate.
+// The window is split into ten buckets that expire one at a time.
+//
+// Percentiles are exact over up to WithPercentiles' sampleSize samples spread
+// over the buckets, sampled uniformly within busy buckets. Slope is the change
+// in mean latency between consecutive buckets, and drift compares the mean of
+// the newer half of the window with the older half. Estimators given with
+// WithQuantileEstimator keep their own sample-count window. Zero or negative
+// values disable the time window.
+func WithTimeWindow(window time.Duration) Option {
+	return func(t *emaTracker) {
+		t.timeWindow = max(window, 0)
 	}
 }
@@ -0,0 +1,142 @@
+package floodgate
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// QuantileValue is the latency at a tracked quantile.
+type QuantileValue struct {
+	Quantile float64
+	Value    time.Duration
+}
+
+// QuantileThreshold escalates to Level once the latency at Quantile exceeds
+// Latency. The quantile must be tracked, see WithQuantiles.
+type QuantileThreshold struct {
+	Quantile float64
+	Latency  time.Duration
+	Level    Level
+}
+
+// defaultQuantiles are always tracked when percentiles are enabled.
+var defaultQuantiles = []float64{0.50, 0.95, 0.99}
+
+// quantileEpsilon is how close two quantiles must be to be the same one.
+const quantileEpsilon = 1e-9
+
+// Quantile returns the latency at tracked quantile q, e.g. 0.999 for P99.9 or
+// 1 for the maximum, or zero if q is not tracked or there are too few samples.
+func (stats Stats) Quantile(q float64) time.Duration {
+	for _, qv := range stats.Quantiles {
+		if math.Abs(qv.Quantile-q) < quantileEpsilon {
+			return qv.Value
+		}
+	}
+
+	// Stats built without Quantiles still carry the default percentiles
+	switch {
+	case math.Abs(q-0.50) < quantileEpsilon:
+		return stats.P50
+	case math.Abs(q-0.95) < quantileEpsilon:
+		return stats.P95
+	case math.Abs(q-0.99) < quantileEpsilon:
+		return stats.P99
+	}
+	return 0
+}
+
+// mergeQuantiles returns the quantiles of a and b clamped to [0, 1], sorted
+// and without duplicates.
+func mergeQuantiles(a, b []float64) []float64 {
+	merged := make([]float64, 0, len(a)+len(b))
+	for _, q := range slices.Concat(a, b) {
+		merged = append(merged, min(max(q, 0), 1))
+	}
+	slices.Sort(merged)
+	return slices.CompactFunc(merged, func(x, y float64) bool {
+		return math.Abs(x-y) < quantileEpsilon
+	})
+}
+
+// QuantileEstimator summarizes recent latency samples for a tracker's
+// percentiles. The tracker serializes calls, so implementations need not be
+// safe for concurrent use.
+//
+// Three estimators are provided:
+//
+//   - the default exact sample ring, enabled by WithPercentiles, which sorts the
+//     last N samples when percentiles are read
+//   - NewDDSketch, with a guaranteed relative error on every quantile
+//   - NewTDigest, with a rank error that shrinks towards the tails
+type QuantileEstimator interface {
+	// Add records a sample.
+	Add(value time.Duration)
+
+	// Quantile returns the estimated q-quantile, 0 <= q <= 1, of the samples
+	// summarized, or zero if there are none.
+	Quantile(q float64) time.Duration
+
+	// Count returns the number of samples summarized.
+	Count() int
+
+	// Scale multiplies every summarized sample by factor. Trackers use it to
+	// decay stale samples.
+	Scale(factor float64)
+}
+
+// sampleRing is the exact estimator. It keeps the last size samples and
+// sorts a copy of them the first time a quantile is read after a change.
+type sampleRing struct {
+	samples []int64
+	sorted  []int64
+	size    int
+	next    int
+	dirty   bool
+}
+
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{
+		samples: make([]int64, 0, size),
+		sorted:  make([]int64, 0, size),
+		size:    size,
+	}
+}
+
+func (r *sampleRing) Add(value time.Duration) {
+	if len(r.samples) < r.size {
+		r.samples = append(r.samples, int64(value))
+	} else {
+		r.samples[r.next] = int64(value)
+		r.next = (r.next + 1) % r.size
+	}
+	r.dirty = true
+}
+
+func (r *sampleRing) Quantile(q float64) time.Duration {
+	n := len(r.samples)
+	if n == 0 {
+		return 0
+	}
+
+	if r.dirty {
+		r.sorted = append(r.sorted[:0], r.samples...)
+		slices.Sort(r.sorted)
+		r.dirty = false
+	}
+
+	i := min(int(math.Floor(q*float64(n)+1e-9)), n-1)
+	return time.Duration(r.sorted[max(i, 0)])
+}
+
+func (r *sampleRing) Count() int {
+	return len(r.samples)
+}
+
+func (r *sampleRing) Scale(factor float64) {
+	for i := range r.samples {
+		r.samples[i] = int64(float64(r.samples[i]) * factor)
+	}
+	r.dirty = true
+}
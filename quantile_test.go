@@ -0,0 +1,275 @@
+package floodgate
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+// latencySamples returns n log-normally distributed latencies around 50ms.
+func latencySamples(n int) []time.Duration {
+	rng := rand.New(rand.NewPCG(1, 2))
+	samples := make([]time.Duration, n)
+	for i := range samples {
+		samples[i] = time.Duration(math.Exp(rng.NormFloat64()) * float64(50*time.Millisecond))
+	}
+	return samples
+}
+
+func exactQuantile(sorted []time.Duration, q float64) time.Duration {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+func TestDDSketch_RelativeAccuracy(t *testing.T) {
+	samples := latencySamples(100_000)
+	sketch := NewDDSketch(0.01, 0)
+	for _, v := range samples {
+		sketch.Add(v)
+	}
+	slices.Sort(samples)
+
+	if got := sketch.Count(); got != len(samples) {
+		t.Errorf("Expected count %d, got %d", len(samples), got)
+	}
+
+	for _, q := range []float64{0.5, 0.9, 0.95, 0.99, 0.999} {
+		want := exactQuantile(samples, q)
+		got := sketch.Quantile(q)
+		if err := math.Abs(float64(got-want)) / float64(want); err > 0.01 {
+			t.Errorf("Quantile(%v) = %v, want %v within 1%%, error %.4f", q, got, want, err)
+		}
+	}
+}
+
+func TestDDSketch_BoundedBins(t *testing.T) {
+	sketch := NewDDSketch(0.01, 0)
+	var largest time.Duration
+	for v := time.Duration(1); v < time.Hour; v *= 2 {
+		sketch.Add(v)
+		largest = v
+	}
+	sketch.Add(time.Nanosecond)
+
+	if len(sketch.bins) > ddSketchMaxBins {
+		t.Errorf("Expected at most %d bins, got %d", ddSketchMaxBins, len(sketch.bins))
+	}
+	if got := sketch.Quantile(1); math.Abs(float64(got-largest)) > 0.01*float64(largest) {
+		t.Errorf("Expected max near %v after collapsing, got %v", largest, got)
+	}
+}
+
+func TestTDigest_RankAccuracy(t *testing.T) {
+	samples := latencySamples(100_000)
+	digest := NewTDigest(100, 0)
+	for _, v := range samples {
+		digest.Add(v)
+	}
+	slices.Sort(samples)
+
+	if got := digest.Count(); got != len(samples) {
+		t.Errorf("Expected count %d, got %d", len(samples), got)
+	}
+	if n := len(digest.centroids); n > 100 {
+		t.Errorf("Expected at most 100 centroids, got %d", n)
+	}
+
+	for _, q := range []float64{0.5, 0.9, 0.95, 0.99, 0.999} {
+		got := digest.Quantile(q)
+		rank, _ := slices.BinarySearch(samples, got)
+		bound := math.Pi * math.Sqrt(q*(1-q)) / 100
+		if err := math.Abs(float64(rank)/float64(len(samples)) - q); err > bound {
+			t.Errorf("Quantile(%v) = %v at rank %.4f, want within %.4f", q, got, float64(rank)/float64(len(samples)), bound)
+		}
+	}
+}
+
+func TestQuantileEstimators_Window(t *testing.T) {
+	estimators := map[string]QuantileEstimator{
+		"ring":     newSampleRing(1000),
+		"ddsketch": NewDDSketch(0.01, 1000),
+		"tdigest":  NewTDigest(100, 1000),
+	}
+
+	for name, estimator := range estimators {
+		t.Run(name, func(t *testing.T) {
+			for range 1000 {
+				estimator.Add(10 * time.Millisecond)
+			}
+			for range 3000 {
+				estimator.Add(100 * time.Millisecond)
+			}
+
+			if got := estimator.Quantile(0.5); math.Abs(float64(got-100*time.Millisecond)) > float64(2*time.Millisecond) {
+				t.Errorf("Expected old samples to be forgotten, P50 = %v", got)
+			}
+			if got := estimator.Count(); got > 2000 {
+				t.Errorf("Expected count bounded by the window, got %d", got)
+			}
+		})
+	}
+}
+
+func TestQuantileEstimators_Scale(t *testing.T) {
+	estimators := map[string]QuantileEstimator{
+		"ring":     newSampleRing(100),
+		"ddsketch": NewDDSketch(0.01, 0),
+		"tdigest":  NewTDigest(100, 0),
+	}
+
+	for name, estimator := range estimators {
+		t.Run(name, func(t *testing.T) {
+			for range 100 {
+				estimator.Add(100 * time.Millisecond)
+			}
+			estimator.Scale(0.25)
+
+			if got := estimator.Quantile(0.95); math.Abs(float64(got-25*time.Millisecond)) > float64(time.Millisecond) {
+				t.Errorf("Expected P95 near 25ms after scaling, got %v", got)
+			}
+		})
+	}
+}
+
+func TestTracker_QuantileEstimator(t *testing.T) {
+	tracker := NewTracker(
+		WithWindowSize(20),
+		WithQuantileEstimator(NewDDSketch(0.01, 1000)),
+	)
+
+	for i := 1; i <= 1000; i++ {
+		tracker.Process(time.Duration(i) * time.Millisecond)
+	}
+
+	stats := tracker.Value()
+	if math.Abs(float64(stats.P95-950*time.Millisecond)) > 0.02*float64(950*time.Millisecond) {
+		t.Errorf("Expected P95 near 950ms, got %v", stats.P95)
+	}
+	if math.Abs(float64(stats.P99-990*time.Millisecond)) > 0.02*float64(990*time.Millisecond) {
+		t.Errorf("Expected P99 near 990ms, got %v", stats.P99)
+	}
+}
+
+func BenchmarkDDSketch_Add(b *testing.B) {
+	samples := latencySamples(1024)
+	sketch := NewDDSketch(0.01, 1000)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sketch.Add(samples[i%len(samples)])
+	}
+}
+
+func BenchmarkTDigest_Add(b *testing.B) {
+	samples := latencySamples(1024)
+	digest := NewTDigest(100, 1000)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		digest.Add(samples[i%len(samples)])
+	}
+}
+
+// BenchmarkTracker_ProcessAndValueEstimators measures the request path with
+// every estimator: one Process and one Value per request.
+func BenchmarkTracker_ProcessAndValueEstimators(b *testing.B) {
+	estimators := map[string]func() QuantileEstimator{
+		"ring":     func() QuantileEstimator { return newSampleRing(1000) },
+		"ddsketch": func() QuantileEstimator { return NewDDSketch(0.01, 1000) },
+		"tdigest":  func() QuantileEstimator { return NewTDigest(100, 1000) },
+	}
+	samples := latencySamples(1024)
+
+	for name, newEstimator := range estimators {
+		b.Run(name, func(b *testing.B) {
+			tracker := NewTracker(
+				WithPercentiles(1000),
+				WithQuantileEstimator(newEstimator()),
+			)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tracker.Process(samples[i%len(samples)])
+				_ = tracker.Value()
+			}
+		})
+	}
+}
+
+func TestTracker_WithQuantiles(t *testing.T) {
+	tracker := NewTracker(
+		WithPercentiles(1000),
+		WithQuantiles(0.999, 0.9, 1, 0.95),
+	)
+
+	for i := 1; i <= 1000; i++ {
+		tracker.Process(time.Duration(i) * time.Millisecond)
+	}
+
+	stats := tracker.Value()
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.5, 501 * time.Millisecond},
+		{0.9, 901 * time.Millisecond},
+		{0.99, 991 * time.Millisecond},
+		{0.999, 1000 * time.Millisecond},
+		{1, 1000 * time.Millisecond},
+		{0.8, 0}, // not tracked
+	}
+	for _, tt := range tests {
+		if got := stats.Quantile(tt.q); got != tt.want {
+			t.Errorf("Quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	if n := len(stats.Quantiles); n != 6 {
+		t.Errorf("Expected 6 tracked quantiles without duplicates, got %d", n)
+	}
+	if stats.P99 != 991*time.Millisecond {
+		t.Errorf("Expected P99 of 991ms, got %v", stats.P99)
+	}
+	if got := stats.Percentile(0.995); got != 1000*time.Millisecond {
+		t.Errorf("Expected Percentile(0.995) to use P99.9, got %v", got)
+	}
+}
+
+func TestThresholdPolicy_QuantileThresholds(t *testing.T) {
+	thresholds := DefaultThresholds()
+	thresholds.Quantiles = []QuantileThreshold{
+		{Quantile: 0.999, Latency: 3 * time.Second, Level: Critical},
+		{Quantile: 0.9, Latency: 800 * time.Millisecond, Level: Moderate},
+	}
+	policy := ThresholdPolicy{Thresholds: thresholds}
+
+	stats := Stats{
+		P50: 100 * time.Millisecond,
+		P95: 200 * time.Millisecond,
+		P99: 300 * time.Millisecond,
+		Quantiles: []QuantileValue{
+			{Quantile: 0.9, Value: 900 * time.Millisecond},
+			{Quantile: 0.999, Value: 4 * time.Second},
+		},
+	}
+	if level, reason := policy.Evaluate(stats); level != Critical || reason != ReasonQuantileThreshold {
+		t.Errorf("Expected Critical from the P99.9 threshold, got %v (%v)", level, reason)
+	}
+
+	// Exit thresholds scale the quantile thresholds too
+	exit := ThresholdPolicy{Thresholds: thresholds.Scale(0.5)}
+	stats.Quantiles[1].Value = 2 * time.Second
+	if level, _ := exit.Evaluate(stats); level != Critical {
+		t.Errorf("Expected Critical against the scaled threshold, got %v", level)
+	}
+
+	// A more severe built-in level wins
+	stats.P99 = 20 * time.Second
+	if level, reason := policy.Evaluate(stats); level != Emergency || reason != ReasonP99Emergency {
+		t.Errorf("Expected Emergency from P99, got %v (%v)", level, reason)
+	}
+}
@@ -0,0 +1,314 @@
+package floodgate
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// ResourceStats are process and container resource signals. Latency is a
+// lagging indicator; these often move before P95 does.
+type ResourceStats struct {
+	// Goroutines is the number of live goroutines.
+	Goroutines uint64
+
+	// GCPauseP99 and SchedLatencyP99 are the 99th percentile stop-the-world
+	// GC pause and time goroutines spent runnable before running, over the
+	// last sample interval.
+	GCPauseP99      time.Duration
+	SchedLatencyP99 time.Duration
+
+	// HeapLimitRatio is the memory the Go runtime holds as a fraction of
+	// GOMEMLIMIT. It is zero when no limit is set.
+	HeapLimitRatio float64
+
+	// CgroupCPURatio is CPU usage over the last sample interval as a fraction
+	// of the cgroup v2 CPU quota. It is zero when no quota is set.
+	CgroupCPURatio float64
+
+	// CgroupMemoryRatio is the cgroup v2 working set, memory usage less
+	// reclaimable page cache, as a fraction of its limit. It is zero when no
+	// limit is set.
+	CgroupMemoryRatio float64
+}
+
+// ResourceThresholds hold the resource levels at which backpressure starts.
+// A zero threshold disables its check.
+type ResourceThresholds struct {
+	MemoryEmergency      float64 // HeapLimitRatio or CgroupMemoryRatio
+	MemoryCritical       float64 // HeapLimitRatio or CgroupMemoryRatio
+	CPUCritical          float64 // CgroupCPURatio
+	GCPauseCritical      time.Duration
+	SchedLatencyCritical time.Duration
+	SchedLatencyWarning  time.Duration
+	GoroutinesModerate   uint64
+}
+
+// DefaultResourceThresholds returns sensible default thresholds.
+func DefaultResourceThresholds() ResourceThresholds {
+	return ResourceThresholds{
+		MemoryEmergency:      0.95,
+		MemoryCritical:       0.9,
+		CPUCritical:          0.95,
+		GCPauseCritical:      50 * time.Millisecond,
+		SchedLatencyCritical: 50 * time.Millisecond,
+		SchedLatencyWarning:  10 * time.Millisecond,
+		GoroutinesModerate:   100_000,
+	}
+}
+
+// Reasons reported by a ResourceMonitor.
+const (
+	ReasonMemoryEmergency      Reason = "memory_emergency"
+	ReasonMemoryCritical       Reason = "memory_critical"
+	ReasonCPUCritical          Reason = "cpu_critical"
+	ReasonGCPauseCritical      Reason = "gc_pause_critical"
+	ReasonSchedLatencyCritical Reason = "sched_latency_critical"
+	ReasonSchedLatencyWarning  Reason = "sched_latency_warning"
+	ReasonGoroutinesModerate   Reason = "goroutines_moderate"
+)
+
+// Level returns the backpressure level for stats and the reason it was chosen.
+func (t ResourceThresholds) Level(stats ResourceStats) (Level, Reason) {
+	memory := max(stats.HeapLimitRatio, stats.CgroupMemoryRatio)
+
+	switch {
+	case t.MemoryEmergency > 0 && memory >= t.MemoryEmergency:
+		return Emergency, ReasonMemoryEmergency
+	case t.MemoryCritical > 0 && memory >= t.MemoryCritical:
+		return Critical, ReasonMemoryCritical
+	case t.CPUCritical > 0 && stats.CgroupCPURatio >= t.CPUCritical:
+		return Critical, ReasonCPUCritical
+	case t.GCPauseCritical > 0 && stats.GCPauseP99 >= t.GCPauseCritical:
+		return Critical, ReasonGCPauseCritical
+	case t.SchedLatencyCritical > 0 && stats.SchedLatencyP99 >= t.SchedLatencyCritical:
+		return Critical, ReasonSchedLatencyCritical
+	case t.GoroutinesModerate > 0 && stats.Goroutines >= t.GoroutinesModerate:
+		return Moderate, ReasonGoroutinesModerate
+	case t.SchedLatencyWarning > 0 && stats.SchedLatencyP99 >= t.SchedLatencyWarning:
+		return Warning, ReasonSchedLatencyWarning
+	}
+	return Normal, ReasonWithinThresholds
+}
+
+// ResourceConfig holds configuration for a ResourceMonitor.
+type ResourceConfig struct {
+	// Interval is how often resources are sampled.
+	Interval time.Duration
+
+	Thresholds ResourceThresholds
+
+	// CgroupPath is the cgroup v2 directory of the process. If empty, uses
+	// /sys/fs/cgroup. Cgroup signals are skipped when it cannot be read.
+	CgroupPath string
+
+	// Logger for level changes. If nil, uses DefaultLogger.
+	Logger Logger
+}
+
+// DefaultResourceConfig returns sensible default configuration.
+func DefaultResourceConfig() ResourceConfig {
+	return ResourceConfig{
+		Interval:   time.Second,
+		Thresholds: DefaultResourceThresholds(),
+		CgroupPath: "/sys/fs/cgroup",
+		Logger:     NewDefaultLogger(),
+	}
+}
+
+// ResourceMonitor periodically samples Go runtime metrics and cgroup v2 CPU
+// and memory, and turns them into a process-wide Level.
+//
+// ResourceMonitor implements LevelPolicy, reporting the process level for any
+// stats. Set it as GateConfig.Resources to combine it with every key's latency
+// level, or add it to a CompositePolicy.
+//
+// Example:
+//
+//	monitor := floodgate.NewResourceMonitor(ctx, floodgate.DefaultResourceConfig())
+//	cfg.Resources = monitor
+type ResourceMonitor struct {
+	cfg    ResourceConfig
+	logger Logger
+
+	current atomic.Pointer[resourceSample]
+
+	// Sampler state, only used by the sampling goroutine
+	samples  []metrics.Sample
+	gcPauses *metrics.Float64Histogram
+	schedLat *metrics.Float64Histogram
+	cgroup   cgroupReader
+}
+
+// resourceSample is the result of one sample.
+type resourceSample struct {
+	stats  ResourceStats
+	level  Level
+	reason Reason
+}
+
+// Go runtime metrics read by the monitor.
+const (
+	metricGoroutines    = "/sched/goroutines:goroutines"
+	metricGCPauses      = "/sched/pauses/total/gc:seconds"
+	metricSchedLatency  = "/sched/latencies:seconds"
+	metricMemoryTotal   = "/memory/classes/total:bytes"
+	metricMemoryRelease = "/memory/classes/heap/released:bytes"
+	metricMemoryLimit   = "/gc/gomemlimit:bytes"
+)
+
+// NewResourceMonitor creates a monitor and takes its first sample. Sampling
+// stops when ctx is cancelled.
+func NewResourceMonitor(ctx context.Context, cfg ResourceConfig) *ResourceMonitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.CgroupPath == "" {
+		cfg.CgroupPath = "/sys/fs/cgroup"
+	}
+
+	// Use provided logger or default
+	logger := cfg.Logger
+	if logger == nil {
+		logger = NewDefaultLogger()
+	}
+
+	m := &ResourceMonitor{
+		cfg:    cfg,
+		logger: logger,
+		samples: []metrics.Sample{
+			{Name: metricGoroutines},
+			{Name: metricGCPauses},
+			{Name: metricSchedLatency},
+			{Name: metricMemoryTotal},
+			{Name: metricMemoryRelease},
+			{Name: metricMemoryLimit},
+		},
+		cgroup: cgroupReader{path: cfg.CgroupPath},
+	}
+
+	m.sample(ctx)
+	go m.run(ctx)
+
+	return m
+}
+
+func (m *ResourceMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sample(ctx)
+		}
+	}
+}
+
+// Stats returns the latest resource sample.
+func (m *ResourceMonitor) Stats() ResourceStats {
+	return m.current.Load().stats
+}
+
+// Level returns the latest process level and the reason it was chosen.
+func (m *ResourceMonitor) Level() (Level, Reason) {
+	sample := m.current.Load()
+	return sample.level, sample.reason
+}
+
+// Evaluate implements LevelPolicy. It ignores stats and reports the process level.
+func (m *ResourceMonitor) Evaluate(Stats) (Level, Reason) {
+	return m.Level()
+}
+
+// sample reads every signal and publishes the resulting level.
+func (m *ResourceMonitor) sample(ctx context.Context) {
+	metrics.Read(m.samples)
+
+	var stats ResourceStats
+	if v := m.samples[0].Value; v.Kind() == metrics.KindUint64 {
+		stats.Goroutines = v.Uint64()
+	}
+	if v := m.samples[1].Value; v.Kind() == metrics.KindFloat64Histogram {
+		current := v.Float64Histogram()
+		stats.GCPauseP99 = histogramQuantile(m.gcPauses, current, 0.99)
+		m.gcPauses = cloneHistogram(current)
+	}
+	if v := m.samples[2].Value; v.Kind() == metrics.KindFloat64Histogram {
+		current := v.Float64Histogram()
+		stats.SchedLatencyP99 = histogramQuantile(m.schedLat, current, 0.99)
+		m.schedLat = cloneHistogram(current)
+	}
+	if m.samples[3].Value.Kind() == metrics.KindUint64 && m.samples[5].Value.Kind() == metrics.KindUint64 {
+		held := m.samples[3].Value.Uint64()
+		if m.samples[4].Value.Kind() == metrics.KindUint64 {
+			held -= m.samples[4].Value.Uint64()
+		}
+		// GOMEMLIMIT is math.MaxInt64 when unset
+		if limit := m.samples[5].Value.Uint64(); limit > 0 && limit < math.MaxInt64 {
+			stats.HeapLimitRatio = float64(held) / float64(limit)
+		}
+	}
+	stats.CgroupCPURatio = m.cgroup.cpuRatio(time.Now())
+	stats.CgroupMemoryRatio = m.cgroup.memoryRatio()
+
+	level, reason := m.cfg.Thresholds.Level(stats)
+
+	previous := m.current.Swap(&resourceSample{stats: stats, level: level, reason: reason})
+	if previous != nil && previous.level != level {
+		m.logger.WarnContext(ctx, "resource level changed",
+			"from", previous.level,
+			"level", level,
+			"reason", reason,
+			"goroutines", stats.Goroutines,
+			"gc_pause_p99", stats.GCPauseP99,
+			"sched_latency_p99", stats.SchedLatencyP99,
+			"heap_limit_ratio", stats.HeapLimitRatio,
+			"cgroup_cpu_ratio", stats.CgroupCPURatio,
+			"cgroup_memory_ratio", stats.CgroupMemoryRatio)
+	}
+}
+
+// histogramQuantile returns quantile q of the samples added to a cumulative
+// runtime histogram between previous and current. A nil previous uses every
+// sample in current. It returns zero when no samples were added.
+func histogramQuantile(previous, current *metrics.Float64Histogram, q float64) time.Duration {
+	var total uint64
+	deltas := make([]uint64, len(current.Counts))
+	for i, count := range current.Counts {
+		if previous != nil && i < len(previous.Counts) {
+			count -= previous.Counts[i]
+		}
+		deltas[i] = count
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, count := range deltas {
+		seen += count
+		if seen >= rank {
+			// Report the bucket's upper bound, or its lower bound for the
+			// unbounded last bucket
+			upper := current.Buckets[i+1]
+			if math.IsInf(upper, 1) {
+				upper = current.Buckets[i]
+			}
+			return time.Duration(upper * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+func cloneHistogram(h *metrics.Float64Histogram) *metrics.Float64Histogram {
+	return &metrics.Float64Histogram{
+		Counts:  append([]uint64(nil), h.Counts...),
+		Buckets: h.Buckets,
+	}
+}
@@ -0,0 +1,121 @@
+package floodgate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"testing"
+	"time"
+)
+
+func TestResourceThresholds_Level(t *testing.T) {
+	thresholds := DefaultResourceThresholds()
+
+	tests := []struct {
+		name   string
+		stats  ResourceStats
+		level  Level
+		reason Reason
+	}{
+		{"idle", ResourceStats{Goroutines: 50}, Normal, ReasonWithinThresholds},
+		{"near GOMEMLIMIT", ResourceStats{HeapLimitRatio: 0.97}, Emergency, ReasonMemoryEmergency},
+		{"cgroup memory", ResourceStats{CgroupMemoryRatio: 0.92}, Critical, ReasonMemoryCritical},
+		{"cpu throttled", ResourceStats{CgroupCPURatio: 1.0}, Critical, ReasonCPUCritical},
+		{"long gc pauses", ResourceStats{GCPauseP99: 80 * time.Millisecond}, Critical, ReasonGCPauseCritical},
+		{"goroutine explosion", ResourceStats{Goroutines: 200_000}, Moderate, ReasonGoroutinesModerate},
+		{"scheduler lag", ResourceStats{SchedLatencyP99: 20 * time.Millisecond}, Warning, ReasonSchedLatencyWarning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, reason := thresholds.Level(tt.stats)
+			if level != tt.level || reason != tt.reason {
+				t.Errorf("Level() = %v (%s), want %v (%s)", level, reason, tt.level, tt.reason)
+			}
+		})
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []float64{0, 0.001, 0.01, 0.1, 1}
+	previous := &metrics.Float64Histogram{Counts: []uint64{100, 0, 0, 0}, Buckets: buckets}
+	current := &metrics.Float64Histogram{Counts: []uint64{100, 90, 9, 1}, Buckets: buckets}
+
+	// 100 new samples: the 99th lands in the 10ms-100ms bucket
+	if got := histogramQuantile(previous, current, 0.99); got != 100*time.Millisecond {
+		t.Errorf("Expected p99 of 100ms, got %v", got)
+	}
+	if got := histogramQuantile(current, current, 0.99); got != 0 {
+		t.Errorf("Expected zero without new samples, got %v", got)
+	}
+}
+
+func TestCgroupReader(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("cpu.max", "200000 100000\n")
+	write("cpu.stat", "usage_usec 1000000\nuser_usec 800000\n")
+	write("memory.max", "1000\n")
+	write("memory.current", "250\n")
+
+	cgroup := cgroupReader{path: dir}
+	start := time.Now()
+	if ratio := cgroup.cpuRatio(start); ratio != 0 {
+		t.Errorf("Expected zero CPU ratio on first sample, got %v", ratio)
+	}
+
+	// 1s of CPU over 1s of wall time with a 2 core quota
+	write("cpu.stat", "usage_usec 2000000\n")
+	if ratio := cgroup.cpuRatio(start.Add(time.Second)); ratio != 0.5 {
+		t.Errorf("Expected CPU ratio 0.5, got %v", ratio)
+	}
+
+	if ratio := cgroup.memoryRatio(); ratio != 0.25 {
+		t.Errorf("Expected memory ratio 0.25, got %v", ratio)
+	}
+
+	// Reclaimable page cache is not counted
+	write("memory.current", "900\n")
+	write("memory.stat", "anon 200\nfile 700\nactive_file 50\ninactive_file 650\n")
+	if ratio := cgroup.memoryRatio(); ratio != 0.25 {
+		t.Errorf("Expected working set ratio 0.25, got %v", ratio)
+	}
+
+	write("memory.max", "max\n")
+	if ratio := cgroup.memoryRatio(); ratio != 0 {
+		t.Errorf("Expected zero memory ratio without a limit, got %v", ratio)
+	}
+}
+
+func TestGate_ResourceLevel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	monitor := NewResourceMonitor(ctx, ResourceConfig{
+		Interval:   time.Hour,
+		Thresholds: ResourceThresholds{GoroutinesModerate: 1},
+		CgroupPath: t.TempDir(),
+		Logger:     NoOpLogger{},
+	})
+	if monitor.Stats().Goroutines == 0 {
+		t.Fatal("Expected goroutines to be sampled")
+	}
+
+	cfg := testGateConfig()
+	cfg.Resources = monitor
+	gate := NewGate(ctx, cfg)
+
+	decision, err := gate.Admit(ctx, "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Level != Moderate || decision.Reason != ReasonGoroutinesModerate {
+		t.Errorf("Expected resource level to apply, got %v (%s)", decision.Level, decision.Reason)
+	}
+	decision.Done(time.Millisecond, nil)
+}
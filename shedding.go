@@ -0,0 +1,65 @@
+package floodgate
+
+import "time"
+
+// DefaultMaxShedRatio is the rejection ratio cap used when none is configured.
+const DefaultMaxShedRatio = 0.9
+
+// ShedPolicy decides what fraction of requests to reject for an overloaded key.
+// It replaces all-or-nothing rejection at the Critical level with a rejection
+// probability that grows with load. Emergency still rejects every request.
+type ShedPolicy interface {
+	// RejectRatio returns the fraction of requests to reject, in [0, 1].
+	RejectRatio(stats Stats, thresholds Thresholds) float64
+}
+
+// ProportionalShedding rejects a fraction of requests that rises with how far
+// latency is past each threshold, following the shape of the client-side
+// throttling curve from the Google SRE book:
+//
+//	ratio = max(0, (latency - K*threshold) / latency)
+//
+// The curve is evaluated for P95 against P95Moderate, EMA against EMACritical
+// and P99 against P99Emergency, and the largest ratio wins. Shedding therefore
+// starts at 0% when a signal crosses its threshold, reaches 50% at twice the
+// threshold and approaches MaxRatio as latency grows.
+type ProportionalShedding struct {
+	// K multiplies every threshold before shedding starts. Values above 1
+	// tolerate more latency before shedding. Zero uses 1.
+	K float64
+
+	// MaxRatio caps the rejection ratio so a key is never fully shed and
+	// keeps producing fresh latency samples. Zero uses DefaultMaxShedRatio.
+	MaxRatio float64
+}
+
+// RejectRatio implements ShedPolicy.
+func (p ProportionalShedding) RejectRatio(stats Stats, thresholds Thresholds) float64 {
+	k := p.K
+	if k <= 0 {
+		k = 1
+	}
+	maxRatio := p.MaxRatio
+	if maxRatio <= 0 {
+		maxRatio = DefaultMaxShedRatio
+	}
+
+	ratio := overloadRatio(stats.P95, thresholds.P95Moderate, k)
+	ratio = max(ratio, overloadRatio(stats.EMA, thresholds.EMACritical, k))
+	ratio = max(ratio, overloadRatio(stats.P99, thresholds.P99Emergency, k))
+
+	return min(ratio, maxRatio, 1)
+}
+
+// overloadRatio returns max(0, (value - k*threshold) / value).
+func overloadRatio(value, threshold time.Duration, k float64) float64 {
+	if threshold <= 0 || value <= 0 {
+		return 0
+	}
+
+	excess := float64(value) - k*float64(threshold)
+	if excess <= 0 {
+		return 0
+	}
+	return excess / float64(value)
+}
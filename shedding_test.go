@@ -0,0 +1,53 @@
+package floodgate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProportionalShedding_RejectRatio(t *testing.T) {
+	thresholds := DefaultThresholds()
+
+	tests := []struct {
+		name     string
+		policy   ProportionalShedding
+		stats    Stats
+		expected float64
+	}{
+		{
+			name:     "below thresholds",
+			stats:    Stats{EMA: 100 * time.Millisecond, P95: 500 * time.Millisecond, P99: time.Second},
+			expected: 0,
+		},
+		{
+			name:     "P95 at twice moderate",
+			stats:    Stats{EMA: 100 * time.Millisecond, P95: 2 * time.Second, P99: 3 * time.Second},
+			expected: 0.5,
+		},
+		{
+			name:     "K raises the starting point",
+			policy:   ProportionalShedding{K: 2},
+			stats:    Stats{EMA: 100 * time.Millisecond, P95: 2 * time.Second, P99: 3 * time.Second},
+			expected: 0,
+		},
+		{
+			name:     "capped at default max ratio",
+			stats:    Stats{EMA: 10 * time.Second, P95: 100 * time.Second, P99: 200 * time.Second},
+			expected: DefaultMaxShedRatio,
+		},
+		{
+			name:     "capped at configured max ratio",
+			policy:   ProportionalShedding{MaxRatio: 0.5},
+			stats:    Stats{EMA: 10 * time.Second, P95: 100 * time.Second, P99: 200 * time.Second},
+			expected: 0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.RejectRatio(tt.stats, thresholds); got != tt.expected {
+				t.Errorf("RejectRatio() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package floodgate
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// TDigest is a QuantileEstimator that clusters samples into weighted
+// centroids, from "Computing Extremely Accurate Quantiles Using t-Digests"
+// (Dunning and Ertl, 2019). It uses the merging variant with the arcsine
+// scale function, which keeps centroids small near the tails.
+//
+// Its error is on rank rather than value: an estimated q-quantile lies
+// between the true quantiles at about q ± π·√(q(1-q))/compression. With a
+// compression of 100, a P99 estimate is within about 0.3 percentiles of the
+// true P99. Use DDSketch where a bound on the value itself is needed.
+//
+// Add is amortized O(log compression), as samples are buffered and merged in
+// batches, and Quantile is O(compression). Memory is bounded by about
+// 7*compression centroids.
+//
+// To follow changing latency, every weight is halved each window samples, so
+// the digest weighs recent samples most and mostly reflects the last
+// 2*window of them. A window of zero or less never forgets.
+type TDigest struct {
+	compression float64
+	window      int
+
+	centroids []centroid
+	buffer    []centroid
+	scratch   []centroid
+	total     float64
+	added     int
+}
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// NewTDigest creates a TDigest. compression is clamped to at least 20;
+// 100 is a good default.
+func NewTDigest(compression float64, window int) *TDigest {
+	compression = max(compression, 20)
+	size := int(math.Ceil(compression))
+	return &TDigest{
+		compression: compression,
+		window:      window,
+		centroids:   make([]centroid, 0, 2*size),
+		buffer:      make([]centroid, 0, 5*size),
+		scratch:     make([]centroid, 0, 7*size),
+	}
+}
+
+// Add implements QuantileEstimator.
+func (d *TDigest) Add(value time.Duration) {
+	if d.window > 0 && d.added >= d.window {
+		d.halve()
+	}
+	d.added++
+
+	d.buffer = append(d.buffer, centroid{mean: float64(value), weight: 1})
+	if len(d.buffer) == cap(d.buffer) {
+		d.merge()
+	}
+}
+
+// Quantile implements QuantileEstimator.
+func (d *TDigest) Quantile(q float64) time.Duration {
+	d.merge()
+	if len(d.centroids) == 0 {
+		return 0
+	}
+
+	// Interpolate between the midpoints of neighbouring centroids
+	rank := min(max(q, 0), 1) * d.total
+	var seen float64
+	for i, c := range d.centroids {
+		mid := seen + c.weight/2
+		if rank < mid {
+			if i == 0 {
+				return time.Duration(c.mean)
+			}
+			prev := d.centroids[i-1]
+			prevMid := seen - prev.weight/2
+			frac := (rank - prevMid) / (mid - prevMid)
+			return time.Duration(prev.mean + frac*(c.mean-prev.mean))
+		}
+		seen += c.weight
+	}
+	return time.Duration(d.centroids[len(d.centroids)-1].mean)
+}
+
+// Count implements QuantileEstimator. After halving it is the weighted count.
+func (d *TDigest) Count() int {
+	return int(math.Round(d.total)) + len(d.buffer)
+}
+
+// Scale implements QuantileEstimator.
+func (d *TDigest) Scale(factor float64) {
+	for i := range d.centroids {
+		d.centroids[i].mean *= factor
+	}
+	for i := range d.buffer {
+		d.buffer[i].mean *= factor
+	}
+}
+
+// merge folds the buffer into the centroids, combining neighbours while the
+// result stays within the size the scale function allows at its quantile.
+func (d *TDigest) merge() {
+	if len(d.buffer) == 0 {
+		return
+	}
+
+	all := append(d.scratch[:0], d.centroids...)
+	all = append(all, d.buffer...)
+	d.buffer = d.buffer[:0]
+	slices.SortFunc(all, func(a, b centroid) int {
+		return cmp.Compare(a.mean, b.mean)
+	})
+
+	var total float64
+	for _, c := range all {
+		total += c.weight
+	}
+
+	out := d.centroids[:0]
+	current := all[0]
+	var seen float64
+	limit := total * d.quantileLimit(0)
+	for _, c := range all[1:] {
+		if seen+current.weight+c.weight <= limit {
+			current.weight += c.weight
+			current.mean += (c.mean - current.mean) * c.weight / current.weight
+			continue
+		}
+		seen += current.weight
+		out = append(out, current)
+		limit = total * d.quantileLimit(seen/total)
+		current = c
+	}
+	out = append(out, current)
+
+	d.centroids = out
+	d.scratch = all
+	d.total = total
+}
+
+// quantileLimit returns the highest quantile a centroid starting at q may
+// reach: one unit further along the scale function
+// k(q) = compression/(2π) · asin(2q-1).
+func (d *TDigest) quantileLimit(q float64) float64 {
+	k := d.compression/(2*math.Pi)*math.Asin(2*q-1) + 1
+	if k >= d.compression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/d.compression) + 1) / 2
+}
+
+func (d *TDigest) halve() {
+	d.merge()
+	for i := range d.centroids {
+		d.centroids[i].weight /= 2
+	}
+	d.total /= 2
+	d.added = 0
+}
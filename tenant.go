@@ -0,0 +1,145 @@
+package floodgate
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant the request belongs
+// to. Requests with a tenant take part in per-tenant fairness.
+//
+// Example:
+//
+//	ctx = floodgate.WithTenant(ctx, customerID)
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant carried by ctx, or "" if it has none.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// tenantID identifies a tenant's state for one key.
+type tenantID struct {
+	key    string
+	tenant string
+}
+
+// tenantState counts a tenant's in-flight requests to one key and its recent
+// load on it.
+type tenantState struct {
+	inFlight atomic.Int64
+
+	// load and prevLoad are the tenant's load in the window numbered epoch
+	// and the one before it; they are guarded by the key's tenantLoads.
+	epoch    int64
+	load     float64
+	prevLoad float64
+}
+
+// overFairShare reports whether a tenant with inFlight requests would hold
+// more than its fair share of a key's in-flight requests if one more request
+// were admitted. The fair share is the key's in-flight requests divided
+// evenly among tenants with requests in flight, so a lone tenant is never
+// over its share.
+func overFairShare(inFlight, total, activeTenants int64) bool {
+	if inFlight == 0 {
+		activeTenants++
+	}
+	if activeTenants <= 1 {
+		return false
+	}
+	return float64(inFlight) >= float64(total+1)/float64(activeTenants)
+}
+
+const (
+	// tenantLoadWindow is the window over which tenants' recent load is
+	// measured.
+	tenantLoadWindow = 10 * time.Second
+
+	// fairLoadSlack is how far a tenant may exceed an even split of the
+	// recent load before it is over its share, so that tenants with similar
+	// load are not shed because of noise.
+	fairLoadSlack = 1.2
+)
+
+// tenantLoads measures the recent load of a key's tenants: the latency of
+// their completed requests, summed over the current and the previous
+// tenantLoadWindow. Unlike in-flight requests this notices a tenant sending
+// many short requests, few of which are in flight at once.
+type tenantLoads struct {
+	mu sync.Mutex
+
+	// load and prevLoad are the key's load in the window numbered epoch and
+	// the one before it; tenants and prevTenants count the tenants with load
+	// in those windows.
+	epoch       int64
+	load        float64
+	prevLoad    float64
+	tenants     int
+	prevTenants int
+}
+
+// roll moves l and tenant to the window containing now. Call with l.mu held.
+func (l *tenantLoads) roll(tenant *tenantState, now time.Time) {
+	epoch := now.UnixNano() / int64(tenantLoadWindow)
+	switch {
+	case epoch == l.epoch:
+	case epoch == l.epoch+1:
+		l.prevLoad, l.prevTenants = l.load, l.tenants
+		l.load, l.tenants = 0, 0
+	default:
+		l.prevLoad, l.prevTenants = 0, 0
+		l.load, l.tenants = 0, 0
+	}
+	l.epoch = epoch
+
+	switch {
+	case tenant.epoch == epoch:
+	case tenant.epoch == epoch-1:
+		tenant.prevLoad, tenant.load = tenant.load, 0
+	default:
+		tenant.prevLoad, tenant.load = 0, 0
+	}
+	tenant.epoch = epoch
+}
+
+// add records a completed request of tenant that took latency.
+func (l *tenantLoads) add(tenant *tenantState, latency time.Duration, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.roll(tenant, now)
+	if tenant.load == 0 {
+		l.tenants++
+	}
+	tenant.load += latency.Seconds()
+	l.load += latency.Seconds()
+}
+
+// overFairShare reports whether tenant's recent load exceeds an even split
+// of the key's recent load among its recently active tenants by more than
+// fairLoadSlack. A lone tenant is never over its share.
+func (l *tenantLoads) overFairShare(tenant *tenantState, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.roll(tenant, now)
+	tenants := max(l.tenants, l.prevTenants)
+	if tenants <= 1 {
+		return false
+	}
+
+	// Count the part of the previous window still within the last
+	// tenantLoadWindow
+	elapsed := float64(now.UnixNano()%int64(tenantLoadWindow)) / float64(tenantLoadWindow)
+	keyLoad := l.load + (1-elapsed)*l.prevLoad
+	tenantLoad := tenant.load + (1-elapsed)*tenant.prevLoad
+	return tenantLoad > fairLoadSlack*keyLoad/float64(tenants)
+}
@@ -0,0 +1,82 @@
+package floodgate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOverFairShare(t *testing.T) {
+	tests := []struct {
+		name                           string
+		inFlight, total, activeTenants int64
+		want                           bool
+	}{
+		{"lone tenant", 10, 10, 1, false},
+		{"new tenant", 0, 10, 1, false},
+		{"equal tenants", 3, 6, 2, false},
+		{"noisy tenant", 5, 6, 2, true},
+		{"quiet tenant", 1, 6, 2, false},
+		{"one of many", 2, 12, 6, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overFairShare(tt.inFlight, tt.total, tt.activeTenants); got != tt.want {
+				t.Errorf("overFairShare(%d, %d, %d) = %v, want %v",
+					tt.inFlight, tt.total, tt.activeTenants, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantLoads_OverFairShare(t *testing.T) {
+	var loads tenantLoads
+	now := time.Unix(0, 0)
+	chatty, quiet, newcomer := &tenantState{}, &tenantState{}, &tenantState{}
+
+	if loads.overFairShare(chatty, now) {
+		t.Error("Expected a tenant without load not to be over its share")
+	}
+
+	// Many short requests add up
+	for range 100 {
+		loads.add(chatty, time.Millisecond, now)
+	}
+	if loads.overFairShare(chatty, now) {
+		t.Error("Expected a lone tenant not to be over its share")
+	}
+
+	for range 10 {
+		loads.add(quiet, time.Millisecond, now)
+	}
+	if !loads.overFairShare(chatty, now) {
+		t.Error("Expected the chatty tenant to be over its share")
+	}
+	if loads.overFairShare(quiet, now) || loads.overFairShare(newcomer, now) {
+		t.Error("Expected other tenants not to be over their share")
+	}
+
+	// Load from the previous window still counts, then ages out
+	if !loads.overFairShare(chatty, now.Add(tenantLoadWindow)) {
+		t.Error("Expected recent load to still count in the next window")
+	}
+	if loads.overFairShare(chatty, now.Add(3*tenantLoadWindow)) {
+		t.Error("Expected old load to age out")
+	}
+}
+
+func TestTenantLoads_SimilarTenants(t *testing.T) {
+	var loads tenantLoads
+	now := time.Unix(0, 0)
+	a, b := &tenantState{}, &tenantState{}
+
+	for range 55 {
+		loads.add(a, time.Millisecond, now)
+	}
+	for range 45 {
+		loads.add(b, time.Millisecond, now)
+	}
+	if loads.overFairShare(a, now) || loads.overFairShare(b, now) {
+		t.Error("Expected tenants with similar load not to be shed")
+	}
+}
@@ -0,0 +1,98 @@
+package floodgate
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultThrottleK is the adaptive throttling multiplier recommended by the
+// Google SRE book.
+const DefaultThrottleK = 2
+
+// throttleBuckets is the number of buckets the throttle window is split into.
+const throttleBuckets = 10
+
+// AdaptiveThrottle implements client-side adaptive throttling from the Google
+// SRE book. It counts requests and the subset accepted by the backend over a
+// sliding window, and rejects new requests locally with probability
+//
+//	max(0, (requests - K*accepts) / (requests + 1))
+//
+// so a client stops sending requests a backend is already refusing.
+type AdaptiveThrottle struct {
+	mu sync.Mutex
+
+	k           float64
+	bucketWidth time.Duration
+	buckets     [throttleBuckets]throttleBucket
+}
+
+type throttleBucket struct {
+	epoch    int64
+	requests int
+	accepts  int
+}
+
+// NewAdaptiveThrottle creates a throttle. Lower k throttles more aggressively;
+// k <= 0 uses DefaultThrottleK. window is how long requests are remembered.
+func NewAdaptiveThrottle(k float64, window time.Duration) *AdaptiveThrottle {
+	if k <= 0 {
+		k = DefaultThrottleK
+	}
+	return &AdaptiveThrottle{
+		k:           k,
+		bucketWidth: max(window/throttleBuckets, time.Millisecond),
+	}
+}
+
+// Allow counts a request and reports whether it may be sent. Requests
+// rejected locally still count, so throttling eases as accepts come back.
+func (t *AdaptiveThrottle) Allow() bool {
+	now := time.Now()
+
+	t.mu.Lock()
+	p := t.rejectProbability(now)
+	t.bucket(now).requests++
+	t.mu.Unlock()
+
+	return !chance(p)
+}
+
+// Accepted records that the backend accepted a request, i.e. processed it
+// rather than rejecting it for overload.
+func (t *AdaptiveThrottle) Accepted() {
+	t.mu.Lock()
+	t.bucket(time.Now()).accepts++
+	t.mu.Unlock()
+}
+
+// RejectProbability returns the current local rejection probability.
+func (t *AdaptiveThrottle) RejectProbability() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rejectProbability(time.Now())
+}
+
+// bucket returns the bucket for now, resetting it if it has expired.
+func (t *AdaptiveThrottle) bucket(now time.Time) *throttleBucket {
+	epoch := now.UnixNano() / int64(t.bucketWidth)
+	b := &t.buckets[epoch%throttleBuckets]
+	if b.epoch != epoch {
+		*b = throttleBucket{epoch: epoch}
+	}
+	return b
+}
+
+func (t *AdaptiveThrottle) rejectProbability(now time.Time) float64 {
+	epoch := now.UnixNano() / int64(t.bucketWidth)
+
+	var requests, accepts int
+	for _, b := range t.buckets {
+		if epoch-b.epoch < throttleBuckets {
+			requests += b.requests
+			accepts += b.accepts
+		}
+	}
+
+	return max(0, (float64(requests)-t.k*float64(accepts))/float64(requests+1))
+}
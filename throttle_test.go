@@ -0,0 +1,44 @@
+package floodgate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveThrottle_RejectProbability(t *testing.T) {
+	throttle := NewAdaptiveThrottle(2, time.Minute)
+
+	// Every request accepted: never throttle
+	for range 10 {
+		throttle.Allow()
+		throttle.Accepted()
+	}
+	if p := throttle.RejectProbability(); p != 0 {
+		t.Errorf("Expected no throttling while accepted, got %v", p)
+	}
+
+	// 30 more requests refused by the backend: (40 - 2*10) / 41
+	for range 30 {
+		throttle.Allow()
+	}
+	want := 20.0 / 41.0
+	if p := throttle.RejectProbability(); p != want {
+		t.Errorf("Expected reject probability %v, got %v", want, p)
+	}
+}
+
+func TestAdaptiveThrottle_WindowExpires(t *testing.T) {
+	throttle := NewAdaptiveThrottle(2, 50*time.Millisecond)
+
+	for range 20 {
+		throttle.Allow()
+	}
+	if throttle.RejectProbability() == 0 {
+		t.Fatal("Expected throttling after refused requests")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if p := throttle.RejectProbability(); p != 0 {
+		t.Errorf("Expected throttling to reset after window, got %v", p)
+	}
+}
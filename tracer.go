@@ -0,0 +1,50 @@
+package floodgate
+
+import "context"
+
+// Tracer records admission decisions in a distributed tracing backend.
+//
+// Like MetricsCollector, the interface keeps the core package free of any
+// tracing dependency. The tracing package provides an OpenTelemetry
+// implementation:
+//
+//	cfg.Tracer = tracing.NewTracer(otel.Tracer("myservice"))
+//
+// To disable tracing entirely:
+//
+//	cfg.Tracer = floodgate.NoOpTracer{}
+type Tracer interface {
+	// StartDecision starts a span for the admission decision of a request to
+	// key (gRPC method or HTTP route). The middleware ends the span once the
+	// request is admitted or rejected, before the handler runs.
+	StartDecision(ctx context.Context, key string) DecisionSpan
+}
+
+// DecisionSpan records the outcome of a single admission decision.
+type DecisionSpan interface {
+	// RecordDecision records the stats and level the decision was based on.
+	// rejected is true for requests rejected by backpressure, load shedding
+	// or the concurrency limiter.
+	RecordDecision(stats Stats, level Level, rejected bool)
+
+	// RecordCircuitBreakerState records the breaker state seen by the request.
+	// rejected is true if the breaker rejected it.
+	RecordCircuitBreakerState(state CircuitState, rejected bool)
+
+	// End finishes the span.
+	End()
+}
+
+// NoOpTracer is a tracer that does nothing (zero overhead).
+type NoOpTracer struct{}
+
+// StartDecision implements Tracer with no-op behavior.
+func (NoOpTracer) StartDecision(ctx context.Context, key string) DecisionSpan {
+	return noOpSpan{}
+}
+
+type noOpSpan struct{}
+
+func (noOpSpan) RecordDecision(stats Stats, level Level, rejected bool)      {}
+func (noOpSpan) RecordCircuitBreakerState(state CircuitState, rejected bool) {}
+func (noOpSpan) End()                                                        {}
@@ -8,4 +8,6 @@ require (
 	go.opentelemetry.io/otel/trace v1.37.0
 )
 
+require github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+
 replace github.com/mushtruk/floodgate => ..
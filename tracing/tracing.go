@@ -19,6 +19,8 @@ package tracing
 
 import (
 	"context"
+	"math"
+	"strconv"
 
 	"github.com/mushtruk/floodgate"
 	"go.opentelemetry.io/otel/attribute"
@@ -62,9 +64,17 @@ func (t *Tracer) RecordBackpressureDecision(span trace.Span, stats floodgate.Sta
 		attribute.Float64("backpressure.p95", stats.P95.Seconds()),
 		attribute.Float64("backpressure.p99", stats.P99.Seconds()),
 		attribute.Float64("backpressure.slope", stats.Slope.Seconds()),
+		attribute.Int("backpressure.samples", stats.Count),
+		attribute.Float64("backpressure.rps", stats.RPS),
 		attribute.Bool("backpressure.rejected", rejected),
 	)
 
+	// Configured quantiles, e.g. backpressure.p99.9
+	for _, qv := range stats.Quantiles {
+		percentile := strconv.FormatFloat(math.Round(qv.Quantile*1e6)/1e4, 'f', -1, 64)
+		span.SetAttributes(attribute.Float64("backpressure.p"+percentile, qv.Value.Seconds()))
+	}
+
 	if rejected {
 		span.SetStatus(codes.Error, "request rejected due to backpressure")
 		span.RecordError(ErrBackpressureRejected{Level: level})
@@ -94,6 +104,31 @@ func (t *Tracer) RecordCircuitBreakerState(span trace.Span, state floodgate.Circ
 	}
 }
 
+// StartDecision implements floodgate.Tracer. It starts a backpressure span
+// and records the decision on it through the methods above.
+func (t *Tracer) StartDecision(ctx context.Context, key string) floodgate.DecisionSpan {
+	_, span := t.StartBackpressureSpan(ctx, key)
+	return decisionSpan{tracer: t, span: span}
+}
+
+// decisionSpan adapts a trace.Span to floodgate.DecisionSpan.
+type decisionSpan struct {
+	tracer *Tracer
+	span   trace.Span
+}
+
+func (s decisionSpan) RecordDecision(stats floodgate.Stats, level floodgate.Level, rejected bool) {
+	s.tracer.RecordBackpressureDecision(s.span, stats, level, rejected)
+}
+
+func (s decisionSpan) RecordCircuitBreakerState(state floodgate.CircuitState, rejected bool) {
+	s.tracer.RecordCircuitBreakerState(s.span, state, rejected)
+}
+
+func (s decisionSpan) End() {
+	s.span.End()
+}
+
 // ErrBackpressureRejected is recorded when a request is rejected due to backpressure.
 type ErrBackpressureRejected struct {
 	Level floodgate.Level
@@ -118,6 +153,11 @@ func (NoOpTracer) StartBackpressureSpan(ctx context.Context, method string) (con
 	return ctx, trace.SpanFromContext(ctx)
 }
 
+// StartDecision implements the floodgate.Tracer interface with no-op behavior.
+func (NoOpTracer) StartDecision(ctx context.Context, key string) floodgate.DecisionSpan {
+	return floodgate.NoOpTracer{}.StartDecision(ctx, key)
+}
+
 // RecordBackpressureDecision implements the Tracer interface with no-op behavior.
 func (NoOpTracer) RecordBackpressureDecision(span trace.Span, stats floodgate.Stats, level floodgate.Level, rejected bool) {
 }
@@ -125,3 +165,9 @@ func (NoOpTracer) RecordBackpressureDecision(span trace.Span, stats floodgate.St
 // RecordCircuitBreakerState implements the Tracer interface with no-op behavior.
 func (NoOpTracer) RecordCircuitBreakerState(span trace.Span, state floodgate.CircuitState, rejected bool) {
 }
+
+// Verify interface compliance at compile time.
+var (
+	_ floodgate.Tracer = (*Tracer)(nil)
+	_ floodgate.Tracer = NoOpTracer{}
+)
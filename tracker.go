@@ -5,13 +5,24 @@
 package floodgate
 
 import (
-	"sort"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const scale = 1024
 
+// clockStart anchors nanotime a day in the past, so that times and window
+// epochs are positive from the first sample.
+var clockStart = time.Now().Add(-24 * time.Hour)
+
+// nanotime returns the nanoseconds since clockStart from the monotonic clock,
+// which is cheaper to read than the wall clock. Trackers keep their times in it.
+func nanotime() int64 {
+	return int64(time.Since(clockStart))
+}
+
 type Tracker[T, V any] interface {
 	Process(T)
 	Value() V
@@ -26,6 +37,31 @@ type Stats struct {
 	P50 time.Duration
 	P95 time.Duration
 	P99 time.Duration
+
+	// Quantiles holds every tracked quantile in ascending order: P50, P95,
+	// P99 and those added with WithQuantiles. It is shared between callers
+	// and must not be modified.
+	Quantiles []QuantileValue
+
+	// Count is the number of samples behind the stats: those in the time
+	// window, those held for percentiles, or every sample processed when
+	// percentiles are disabled.
+	Count int
+
+	// Min and Max are the smallest and largest latency among those samples.
+	// Without a time window they come from the quantile estimator, so they
+	// are approximate for sketches and zero when percentiles are disabled.
+	Min time.Duration
+	Max time.Duration
+
+	// StdDev is the standard deviation of latency over the time window, or
+	// exponentially weighted with the EMA's alpha without one.
+	StdDev time.Duration
+
+	// RPS is the rate of samples per second over the time window, or over
+	// the last 10 to 20 seconds without one. Without a time window it is
+	// measured when the stats are read, so it falls to zero while idle.
+	RPS float64
 }
 
 type Thresholds struct {
@@ -35,6 +71,13 @@ type Thresholds struct {
 	P95Moderate  time.Duration
 	EMAWarning   time.Duration
 	SlopeWarning time.Duration
+
+	// Quantiles are extra thresholds on quantiles tracked with WithQuantiles.
+	Quantiles []QuantileThreshold
+
+	// MinSamples is the Stats.Count below which a key stays Normal, so it is
+	// never escalated on too little data. Zero disables the check.
+	MinSamples int
 }
 
 func DefaultThresholds() Thresholds {
@@ -61,20 +104,55 @@ type emaTracker struct {
 	drift        int64
 	percentDrift float64
 
+	// decayHalfLife enables decay of stale stats; lastSampleAt is from nanotime.
+	decayHalfLife time.Duration
+	lastSampleAt  int64
+
+	// variance is the exponentially weighted variance of latency, updated
+	// with the EMA's alpha.
+	variance float64
+
+	// timeWindow makes percentiles and trend cover a span of time rather than
+	// a number of samples. windowBuckets cover it; bucketWidth is a tenth of
+	// it in nanoseconds. firstSampleAt is from nanotime.
+	timeWindow    time.Duration
+	bucketWidth   int64
+	windowBuckets [timeWindowBuckets]windowBucket
+	firstSampleAt int64
+
+	// rateMarks measure the request rate without a time window. Readers
+	// move them on as windows pass, so the rate falls while idle.
+	rateMarks atomic.Pointer[rateMarks]
+
 	percentileEnabled bool
-	samples           []int64
+	quantiles         QuantileEstimator
 	sampleSize        int
-	sampleIndex       int
-	sortBuffer        []int64
 
-	cachedP50            int64
-	cachedP95            int64
-	cachedP99            int64
-	lastPercentileCalcAt int64
+	quantileList         []float64
+	cachedQuantiles      []QuantileValue
+	cachedMin            time.Duration
+	cachedMax            time.Duration
+	percentileEpoch      int64
 	percentileCacheValid bool
 
-	mu           sync.RWMutex
-	percentileMu sync.RWMutex
+	// mu serializes writers. Readers load the latest published snapshot
+	// instead and never wait for it.
+	mu       sync.Mutex
+	snapshot atomic.Pointer[trackerSnapshot]
+}
+
+// trackerSnapshot is an immutable view of a tracker, published by Process
+// after every sample so that Value can read it without locking.
+type trackerSnapshot struct {
+	stats Stats
+
+	// lastSampleAt is when the latest sample arrived, for decay, and staleAt
+	// is when a window bucket next expires and the stats must be rebuilt.
+	// Both are from nanotime. processed is the number of samples
+	// processed, for the rate of trackers without a time window.
+	lastSampleAt int64
+	staleAt      int64
+	processed    int64
 }
 
 func NewTracker(opts ...Option) Tracker[time.Duration, Stats] {
@@ -90,7 +168,27 @@ func NewTracker(opts ...Option) Tracker[time.Duration, Stats] {
 		opt(t)
 	}
 
+	if t.timeWindow > 0 {
+		t.bucketWidth = max(int64(t.timeWindow/timeWindowBuckets), 1)
+	} else {
+		now := nanotime()
+		t.rateMarks.Store(&rateMarks{previous: rateMark{at: now}, current: rateMark{at: now}})
+	}
+
+	if t.percentileEnabled {
+		t.quantileList = mergeQuantiles(t.quantileList, defaultQuantiles)
+	}
+
+	if t.percentileEnabled && t.quantiles == nil {
+		if t.timeWindow > 0 {
+			t.quantiles = newTimeRing(t.sampleSize, t.timeWindow)
+		} else {
+			t.quantiles = newSampleRing(t.sampleSize)
+		}
+	}
+
 	t.alphaComp = scale - t.alpha
+	t.snapshot.Store(&trackerSnapshot{staleAt: math.MaxInt64})
 	return t
 }
 
@@ -99,9 +197,46 @@ func (t *emaTracker) Process(duration time.Duration) {
 
 	t.mu.Lock()
 
+	// Only time windows and decay need the time of a sample
+	var now int64
+	if t.timeWindow > 0 || t.decayHalfLife > 0 {
+		now = nanotime()
+	}
+	if t.timeWindow > 0 && t.firstSampleAt == 0 {
+		t.firstSampleAt = now
+	}
+
+	// Fold any decay accumulated while idle into the stored state, so stale
+	// samples do not come back at full weight once traffic resumes.
+	factor := 1.0
+	if t.decayHalfLife > 0 {
+		factor = decayFactor(now, t.lastSampleAt, t.decayHalfLife)
+		if factor < 1 {
+			t.emaNanos = int64(float64(t.emaNanos) * factor)
+			for i := range t.emaSlice {
+				t.emaSlice[i] = int64(float64(t.emaSlice[i]) * factor)
+			}
+			t.variance *= factor * factor
+			for i := range t.windowBuckets {
+				b := &t.windowBuckets[i]
+				b.sum = int64(float64(b.sum) * factor)
+				b.sumSquares *= factor * factor
+				b.min = int64(float64(b.min) * factor)
+				b.max = int64(float64(b.max) * factor)
+			}
+			t.calculateTrend()
+		}
+		t.lastSampleAt = now
+	}
+
 	if len(t.emaSlice) == 0 {
 		t.emaNanos = newValue
 	} else {
+		// Exponentially weighted variance around the previous EMA
+		alpha := float64(t.alpha) / scale
+		diff := float64(newValue - t.emaNanos)
+		t.variance = (1 - alpha) * (t.variance + alpha*diff*diff)
+
 		t.emaNanos = (t.alpha*newValue + t.alphaComp*t.emaNanos) >> 10
 	}
 
@@ -113,53 +248,77 @@ func (t *emaTracker) Process(duration time.Duration) {
 	}
 
 	t.processCount++
-	if t.processCount&0x07 == 0 {
+
+	// The trend of a time window is computed when published, as buckets expire
+	if t.timeWindow > 0 {
+		t.addToWindow(timeEpoch(now, t.bucketWidth), newValue)
+	} else if t.processCount&0x07 == 0 {
 		t.calculateTrend()
 	}
 
-	t.mu.Unlock()
-
 	if t.percentileEnabled {
-		t.percentileMu.Lock()
-		if len(t.samples) < t.sampleSize {
-			t.samples = append(t.samples, newValue)
-		} else {
-			t.samples[t.sampleIndex] = newValue
-			t.sampleIndex = (t.sampleIndex + 1) % t.sampleSize
+		if factor < 1 {
+			t.quantiles.Scale(factor)
+			t.percentileCacheValid = false
 		}
 
-		samplesSinceLastCalc := (t.sampleIndex - int(t.lastPercentileCalcAt) + t.sampleSize) % t.sampleSize
-		if samplesSinceLastCalc > t.sampleSize/10 || !t.percentileCacheValid {
+		t.quantiles.Add(duration)
+
+		// Recalculate every tenth of sampleSize samples, and on every sample
+		// until that many have arrived
+		period := int64(max(t.sampleSize/10, 1))
+		if t.processCount%period == 0 || t.processCount <= period {
 			t.percentileCacheValid = false
 		}
+	}
 
-		t.percentileMu.Unlock()
+	// Publishing here keeps the lock and the allocation on the dispatcher,
+	// off the request path
+	t.publish(now)
+	t.mu.Unlock()
+}
+
+// decayFactor returns the multiplier for stats that have received no samples
+// since lastSampleAt. Stats are left untouched for one half-life, then halve
+// every half-life after that.
+func decayFactor(now, lastSampleAt int64, halfLife time.Duration) float64 {
+	if halfLife <= 0 || lastSampleAt == 0 {
+		return 1
 	}
+
+	idle := now - lastSampleAt - int64(halfLife)
+	if idle <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(idle) / float64(halfLife))
 }
 
 func (t *emaTracker) calculateTrend() {
-	n := len(t.emaSlice)
+	t.slope, t.drift, t.percentDrift = trend(t.emaSlice)
+}
+
+// trend returns the average step between consecutive values, and how far the
+// mean of the newer half of values has moved from the older half.
+func trend(values []int64) (slope, drift int64, percentDrift float64) {
+	n := len(values)
 	if n < 4 {
-		t.slope = 0
-		t.drift = 0
-		t.percentDrift = 0
-		return
+		return 0, 0, 0
 	}
 
 	var slopeSum int64
 	for i := 1; i < n; i++ {
-		slopeSum += t.emaSlice[i] - t.emaSlice[i-1]
+		slopeSum += values[i] - values[i-1]
 	}
-	t.slope = slopeSum / int64(n-1)
+	slope = slopeSum / int64(n-1)
 
 	mid := n >> 1
 	var oldSum, newSum int64
 
 	for i := 0; i < mid; i++ {
-		oldSum += t.emaSlice[i]
+		oldSum += values[i]
 	}
 	for i := mid; i < n; i++ {
-		newSum += t.emaSlice[i]
+		newSum += values[i]
 	}
 
 	oldCount := int64(mid)
@@ -167,101 +326,211 @@ func (t *emaTracker) calculateTrend() {
 	historicalAvg := oldSum / oldCount
 	recentAvg := newSum / newCount
 
-	t.drift = recentAvg - historicalAvg
+	drift = recentAvg - historicalAvg
 
 	if historicalAvg != 0 {
-		t.percentDrift = float64(t.drift) / float64(historicalAvg) * 100
-	} else {
-		t.percentDrift = 0
+		percentDrift = float64(drift) / float64(historicalAvg) * 100
 	}
+	return slope, drift, percentDrift
 }
 
-func (t *emaTracker) calculatePercentiles() (p50, p95, p99 time.Duration) {
+// calculateQuantiles returns every tracked quantile and the estimator's
+// sample count, minimum and maximum, recalculating them once enough new
+// samples have arrived. The returned slice is never modified. Callers must
+// hold mu.
+func (t *emaTracker) calculateQuantiles(now int64) (quantiles []QuantileValue, count int, minimum, maximum time.Duration) {
 	if !t.percentileEnabled {
-		return 0, 0, 0
+		return nil, 0, 0, 0
+	}
+
+	// Samples leave a time window as its buckets expire
+	var epoch int64
+	if t.timeWindow > 0 {
+		epoch = timeEpoch(now, t.bucketWidth)
+		if epoch != t.percentileEpoch {
+			t.percentileCacheValid = false
+		}
 	}
 
-	t.percentileMu.Lock()
-	defer t.percentileMu.Unlock()
+	count = t.quantiles.Count()
 
 	// Return cached values if still valid
 	if t.percentileCacheValid {
-		return time.Duration(t.cachedP50),
-			time.Duration(t.cachedP95),
-			time.Duration(t.cachedP99)
+		return t.cachedQuantiles, count, t.cachedMin, t.cachedMax
 	}
 
-	sampleCount := len(t.samples)
-	if sampleCount < 10 {
-		return 0, 0, 0
+	if count < 10 {
+		return nil, count, 0, 0
 	}
 
-	if len(t.sortBuffer) < sampleCount {
-		return 0, 0, 0
+	// Publish a new slice, as callers may still hold the previous one
+	quantiles = make([]QuantileValue, len(t.quantileList))
+	for i, q := range t.quantileList {
+		quantiles[i] = QuantileValue{Quantile: q, Value: t.quantiles.Quantile(q)}
 	}
 
-	// Use pre-allocated sortBuffer to avoid allocation
-	copy(t.sortBuffer[:sampleCount], t.samples[:sampleCount])
+	// Cache the calculated percentiles
+	t.cachedQuantiles = quantiles
+	t.cachedMin = t.quantiles.Quantile(0)
+	t.cachedMax = t.quantiles.Quantile(1)
+	t.percentileEpoch = epoch
+	t.percentileCacheValid = true
+
+	return quantiles, count, t.cachedMin, t.cachedMax
+}
 
-	// Calculate percentile indices
-	p50Index := (sampleCount * 50) / 100
-	p95Index := (sampleCount * 95) / 100
-	p99Index := (sampleCount * 99) / 100
+// Value returns current statistics. It reads the snapshot published by the
+// latest sample without locking. Only once a window bucket has expired since
+// then does a reader rebuild it, and only if the lock is free: otherwise a
+// sample is being processed and will publish a new snapshot.
+func (t *emaTracker) Value() Stats {
+	snapshot := t.snapshot.Load()
 
-	// Clamp indices to valid range
-	if p50Index >= sampleCount {
-		p50Index = sampleCount - 1
-	}
-	if p95Index >= sampleCount {
-		p95Index = sampleCount - 1
+	var now int64
+	if t.decayHalfLife > 0 || snapshot.staleAt != math.MaxInt64 || (t.timeWindow == 0 && snapshot.processed > 0) {
+		now = nanotime()
 	}
-	if p99Index >= sampleCount {
-		p99Index = sampleCount - 1
+	if now >= snapshot.staleAt {
+		snapshot = t.refresh(snapshot, now)
 	}
 
-	// Use partial sort: only sort up to P99 index (saves ~95% of sorting work)
-	// This is O(k log k) where k = p99Index, instead of O(n log n)
-	sortedSamples := t.sortBuffer[:sampleCount]
-
-	// Partial selection sort for the percentiles we need
-	// This is much faster than full sort when we only need a few values
-	partialSort(sortedSamples, p99Index+1)
-
-	// Cache the calculated percentiles
-	t.cachedP50 = sortedSamples[p50Index]
-	t.cachedP95 = sortedSamples[p95Index]
-	t.cachedP99 = sortedSamples[p99Index]
-	t.lastPercentileCalcAt = int64(t.sampleIndex)
-	t.percentileCacheValid = true
+	stats := snapshot.stats
+	if t.timeWindow == 0 && snapshot.processed > 0 {
+		stats.RPS = t.rate(snapshot.processed, now)
+	}
+	if factor := decayFactor(now, snapshot.lastSampleAt, t.decayHalfLife); factor < 1 {
+		stats = stats.scale(factor)
+	}
 
-	return time.Duration(t.cachedP50),
-		time.Duration(t.cachedP95),
-		time.Duration(t.cachedP99)
+	return stats
 }
 
-// partialSort sorts the data using Go's optimized sort.
-// We keep this as a separate function for future optimization opportunities.
-func partialSort(data []int64, k int) {
-	// Use sort.Slice - it uses pdqsort (pattern-defeating quicksort) which is
-	// highly optimized for various data patterns. For P99 percentiles, we need
-	// 99% of the data sorted anyway, so partial sorting doesn't help much.
-	sort.Slice(data, func(i, j int) bool {
-		return data[i] < data[j]
-	})
+// refresh rebuilds a snapshot whose window has expired, or returns it as is
+// if another goroutine holds the lock.
+func (t *emaTracker) refresh(snapshot *trackerSnapshot, now int64) *trackerSnapshot {
+	if !t.mu.TryLock() {
+		return snapshot
+	}
+	defer t.mu.Unlock()
+
+	// Another reader may have rebuilt it already
+	if snapshot := t.snapshot.Load(); now < snapshot.staleAt {
+		return snapshot
+	}
+	return t.publish(now)
 }
 
-// Value returns current statistics.
-func (t *emaTracker) Value() Stats {
-	t.mu.RLock()
+// publish computes the stats as of now and publishes them as a new snapshot.
+// Callers must hold mu.
+func (t *emaTracker) publish(now int64) *trackerSnapshot {
 	stats := Stats{
 		EMA:          time.Duration(t.emaNanos),
 		Slope:        time.Duration(t.slope),
 		Drift:        time.Duration(t.drift),
 		PercentDrift: t.percentDrift,
 	}
-	t.mu.RUnlock()
 
-	stats.P50, stats.P95, stats.P99 = t.calculatePercentiles()
+	var summary windowSummary
+	if t.timeWindow > 0 {
+		summary = t.summarizeWindow(now)
+		stats.RPS = summary.rps
+		slope, drift, percentDrift := t.windowTrend(timeEpoch(now, t.bucketWidth))
+		stats.Slope, stats.Drift, stats.PercentDrift = time.Duration(slope), time.Duration(drift), percentDrift
+		stats.Count = int(summary.count)
+		stats.Min = time.Duration(summary.min)
+		stats.Max = time.Duration(summary.max)
+		stats.StdDev = time.Duration(summary.stdDev)
+	} else {
+		stats.Count = int(t.processCount)
+		stats.StdDev = time.Duration(math.Sqrt(t.variance))
+	}
 
-	return stats
+	quantiles, count, minimum, maximum := t.calculateQuantiles(now)
+	stats.Quantiles = quantiles
+	stats.P50 = stats.Quantile(0.50)
+	stats.P95 = stats.Quantile(0.95)
+	stats.P99 = stats.Quantile(0.99)
+	if t.percentileEnabled && t.timeWindow == 0 {
+		// Without a time window the stats describe the estimator's samples
+		stats.Count, stats.Min, stats.Max = count, minimum, maximum
+	}
+
+	// The window changes when its oldest bucket expires
+	staleAt := int64(math.MaxInt64)
+	if summary.count > 0 {
+		staleAt = (timeEpoch(now, t.bucketWidth) + 1) * t.bucketWidth
+	}
+
+	snapshot := &trackerSnapshot{
+		stats:        stats,
+		lastSampleAt: t.lastSampleAt,
+		staleAt:      staleAt,
+		processed:    t.processCount,
+	}
+	t.snapshot.Store(snapshot)
+	return snapshot
+}
+
+// rateMark is the sample count of a tracker at a point in time.
+type rateMark struct {
+	at    int64
+	count int64
+}
+
+// rateMarks are the sample counts at the start of the previous and the
+// current defaultRateWindow.
+type rateMarks struct {
+	previous rateMark
+	current  rateMark
+}
+
+// rate returns the request rate of a tracker without a time window as of now,
+// given that it has processed count samples, over the time since the start of
+// the previous defaultRateWindow. The first read in a new window moves the
+// marks on.
+func (t *emaTracker) rate(count, now int64) float64 {
+	marks := t.rateMarks.Load()
+	if now-marks.current.at >= int64(defaultRateWindow) {
+		next := &rateMarks{previous: marks.current, current: rateMark{at: now, count: count}}
+		if !t.rateMarks.CompareAndSwap(marks, next) {
+			next = t.rateMarks.Load()
+		}
+		marks = next
+	}
+
+	from := marks.previous
+	span := max(now-from.at, int64(defaultRateWindow/timeWindowBuckets))
+	return float64(max(count-from.count, 0)) / time.Duration(span).Seconds()
+}
+
+// scale returns a copy of stats with every latency signal multiplied by factor.
+// PercentDrift is a ratio of two scaled values, so it is kept as is.
+func (stats Stats) scale(factor float64) Stats {
+	mul := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) * factor)
+	}
+
+	var quantiles []QuantileValue
+	if len(stats.Quantiles) > 0 {
+		quantiles = make([]QuantileValue, len(stats.Quantiles))
+		for i, qv := range stats.Quantiles {
+			quantiles[i] = QuantileValue{Quantile: qv.Quantile, Value: mul(qv.Value)}
+		}
+	}
+
+	return Stats{
+		EMA:          mul(stats.EMA),
+		Slope:        mul(stats.Slope),
+		Drift:        mul(stats.Drift),
+		PercentDrift: stats.PercentDrift,
+		P50:          mul(stats.P50),
+		P95:          mul(stats.P95),
+		P99:          mul(stats.P99),
+		Quantiles:    quantiles,
+		Count:        stats.Count,
+		Min:          mul(stats.Min),
+		Max:          mul(stats.Max),
+		StdDev:       mul(stats.StdDev),
+		RPS:          stats.RPS,
+	}
 }
@@ -32,6 +32,52 @@ func TestTracker_BasicUsage(t *testing.T) {
 	}
 }
 
+func TestTracker_Decay(t *testing.T) {
+	tracker := NewTracker(
+		WithWindowSize(20),
+		WithPercentiles(100),
+		WithDecay(10*time.Millisecond),
+	)
+
+	for i := 0; i < 100; i++ {
+		tracker.Process(100 * time.Millisecond)
+	}
+
+	fresh := tracker.Value()
+	if fresh.P95 != 100*time.Millisecond {
+		t.Fatalf("Expected P95 of 100ms before decay, got %v", fresh.P95)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	stale := tracker.Value()
+	if stale.EMA >= fresh.EMA/4 || stale.P95 >= fresh.P95/4 {
+		t.Errorf("Expected stats to decay, got EMA %v P95 %v", stale.EMA, stale.P95)
+	}
+
+	// A new sample must not bring the stale samples back at full weight
+	tracker.Process(time.Millisecond)
+	if resumed := tracker.Value(); resumed.P95 >= fresh.P95/4 {
+		t.Errorf("Expected decayed samples after resuming, got P95 %v", resumed.P95)
+	}
+}
+
+func TestStats_ScaleKeepsPercentDrift(t *testing.T) {
+	stats := Stats{
+		EMA:          200 * time.Millisecond,
+		Drift:        50 * time.Millisecond,
+		PercentDrift: 25,
+	}
+
+	scaled := stats.scale(0.5)
+	if scaled.EMA != 100*time.Millisecond || scaled.Drift != 25*time.Millisecond {
+		t.Errorf("Expected EMA and drift to halve, got %v and %v", scaled.EMA, scaled.Drift)
+	}
+	if scaled.PercentDrift != 25 {
+		t.Errorf("Expected PercentDrift to stay at 25, got %v", scaled.PercentDrift)
+	}
+}
+
 func TestStats_Level(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -70,6 +116,170 @@ func TestStats_Level(t *testing.T) {
 	}
 }
 
+func TestThresholdPolicy_Reasons(t *testing.T) {
+	policy := ThresholdPolicy{Thresholds: DefaultThresholds()}
+
+	tests := []struct {
+		name   string
+		stats  Stats
+		level  Level
+		reason Reason
+	}{
+		{"Normal", Stats{EMA: 100 * time.Millisecond, P95: 200 * time.Millisecond, P99: 300 * time.Millisecond}, Normal, ReasonWithinThresholds},
+		{"EMAWarning", Stats{EMA: 400 * time.Millisecond, P95: 500 * time.Millisecond, P99: 600 * time.Millisecond}, Warning, ReasonEMAWarning},
+		{"SlopeWarning", Stats{EMA: 100 * time.Millisecond, P95: 200 * time.Millisecond, P99: 300 * time.Millisecond, Slope: 20 * time.Millisecond}, Warning, ReasonSlopeWarning},
+		{"Moderate", Stats{EMA: 100 * time.Millisecond, P95: 1500 * time.Millisecond, P99: 2 * time.Second}, Moderate, ReasonP95Moderate},
+		{"Critical", Stats{EMA: time.Second, P95: 3 * time.Second, P99: 4 * time.Second}, Critical, ReasonP95EMACritical},
+		{"Emergency", Stats{EMA: time.Second, P95: 5 * time.Second, P99: 11 * time.Second}, Emergency, ReasonP99Emergency},
+		{"SlopeFallback", Stats{EMA: 100 * time.Millisecond, Slope: 6 * time.Millisecond}, Critical, ReasonSlopeFallbackCritical},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, reason := policy.Evaluate(tt.stats)
+			if level != tt.level || reason != tt.reason {
+				t.Errorf("Expected %v (%s), got %v (%s)", tt.level, tt.reason, level, reason)
+			}
+		})
+	}
+}
+
+func TestThresholdPolicy_MinSamples(t *testing.T) {
+	thresholds := DefaultThresholds()
+	thresholds.MinSamples = 100
+	policy := ThresholdPolicy{Thresholds: thresholds}
+
+	hot := Stats{EMA: time.Second, P95: 5 * time.Second, P99: 11 * time.Second, Count: 12}
+	if level, reason := policy.Evaluate(hot); level != Normal || reason != ReasonInsufficientSamples {
+		t.Errorf("Expected Normal on too few samples, got %v (%s)", level, reason)
+	}
+
+	hot.Count = 100
+	if level, _ := policy.Evaluate(hot); level != Emergency {
+		t.Errorf("Expected Emergency once enough samples arrive, got %v", level)
+	}
+
+	if exit := thresholds.Scale(DefaultExitRatio); exit.MinSamples != 100 {
+		t.Errorf("Expected Scale to keep MinSamples, got %d", exit.MinSamples)
+	}
+}
+
+func TestTracker_SampleStats(t *testing.T) {
+	tracker := NewTracker(WithPercentiles(100))
+
+	for i := 1; i <= 200; i++ {
+		tracker.Process(time.Duration(i) * time.Millisecond)
+	}
+
+	stats := tracker.Value()
+	if stats.Count != 100 {
+		t.Errorf("Expected count of the 100 buffered samples, got %d", stats.Count)
+	}
+	if stats.Min != 101*time.Millisecond || stats.Max != 200*time.Millisecond {
+		t.Errorf("Expected min 101ms and max 200ms, got %v and %v", stats.Min, stats.Max)
+	}
+	if stats.StdDev <= 0 {
+		t.Errorf("Expected positive StdDev, got %v", stats.StdDev)
+	}
+
+	// A new tracker's rate is measured over at least one 1s bucket
+	if stats.RPS < 150 || stats.RPS > 200 {
+		t.Errorf("Expected RPS near 200, got %v", stats.RPS)
+	}
+}
+
+func TestTracker_RateWithoutTimeWindow(t *testing.T) {
+	tracker := NewTracker().(*emaTracker)
+
+	now := nanotime()
+	second := int64(time.Second)
+	tracker.rateMarks.Store(&rateMarks{previous: rateMark{at: now - 15*second}, current: rateMark{at: now - 5*second, count: 40}})
+	if rps := tracker.rate(100, now); rps < 6.6 || rps > 6.7 {
+		t.Errorf("Expected the rate since the previous mark, got %v", rps)
+	}
+
+	// Once the current window is over, the previous mark moves up
+	now += 5 * second
+	if rps := tracker.rate(100, now); rps != 6 {
+		t.Errorf("Expected the rate over the last window, got %v", rps)
+	}
+	if marks := tracker.rateMarks.Load(); marks.current != (rateMark{at: now, count: 100}) {
+		t.Errorf("Expected a new mark at now, got %+v", marks.current)
+	}
+
+	// Without new samples the rate falls to zero
+	now += 10 * second
+	if rps := tracker.rate(100, now); rps != 0 {
+		t.Errorf("Expected an idle tracker to have no rate, got %v", rps)
+	}
+}
+
+func TestTracker_RateReadAtValue(t *testing.T) {
+	tracker := NewTracker().(*emaTracker)
+	for range 100 {
+		tracker.Process(time.Millisecond)
+	}
+	if stats := tracker.Value(); stats.RPS <= 0 {
+		t.Fatalf("Expected a rate after samples, got %v", stats.RPS)
+	}
+
+	// Windows pass without samples
+	second := int64(time.Second)
+	marks := tracker.rateMarks.Load()
+	tracker.rateMarks.Store(&rateMarks{
+		previous: rateMark{at: marks.previous.at - 30*second},
+		current:  rateMark{at: marks.current.at - 20*second, count: 100},
+	})
+	if stats := tracker.Value(); stats.RPS != 0 {
+		t.Errorf("Expected the rate of an idle tracker to fall to zero, got %v", stats.RPS)
+	}
+}
+
+func TestTracker_SampleStatsTimeWindow(t *testing.T) {
+	tracker := NewTracker(
+		WithPercentiles(100),
+		WithTimeWindow(time.Minute),
+	)
+
+	for range 50 {
+		for _, ms := range []time.Duration{10, 20, 30, 40} {
+			tracker.Process(ms * time.Millisecond)
+		}
+	}
+
+	stats := tracker.Value()
+	if stats.Count != 200 {
+		t.Errorf("Expected count of every sample in the window, got %d", stats.Count)
+	}
+	if stats.Min != 10*time.Millisecond || stats.Max != 40*time.Millisecond {
+		t.Errorf("Expected min 10ms and max 40ms, got %v and %v", stats.Min, stats.Max)
+	}
+
+	// Population standard deviation of 10, 20, 30 and 40ms
+	if want := 11180 * time.Microsecond; stats.StdDev < want-10*time.Microsecond || stats.StdDev > want+10*time.Microsecond {
+		t.Errorf("Expected StdDev near %v, got %v", want, stats.StdDev)
+	}
+}
+
+func TestCompositePolicy_MostSevereWins(t *testing.T) {
+	const reasonQueue Reason = "queue_depth"
+
+	queue := LevelPolicyFunc(func(Stats) (Level, Reason) {
+		return Moderate, reasonQueue
+	})
+	policy := CompositePolicy{ThresholdPolicy{Thresholds: DefaultThresholds()}, queue}
+
+	calm := Stats{EMA: 100 * time.Millisecond, P95: 200 * time.Millisecond, P99: 300 * time.Millisecond}
+	if level, reason := policy.Evaluate(calm); level != Moderate || reason != reasonQueue {
+		t.Errorf("Expected moderate from custom policy, got %v (%s)", level, reason)
+	}
+
+	hot := Stats{EMA: time.Second, P95: 5 * time.Second, P99: 11 * time.Second}
+	if level, reason := policy.Evaluate(hot); level != Emergency || reason != ReasonP99Emergency {
+		t.Errorf("Expected emergency from thresholds, got %v (%s)", level, reason)
+	}
+}
+
 func TestLevel_String(t *testing.T) {
 	tests := []struct {
 		level    Level
@@ -192,6 +402,73 @@ func BenchmarkTracker_ConcurrentProcessAndValue(b *testing.B) {
 	})
 }
 
+// BenchmarkTracker_ConcurrentValue benchmarks request goroutines reading the
+// stats of one hot key
+func BenchmarkTracker_ConcurrentValue(b *testing.B) {
+	tracker := NewTracker(
+		WithAlpha(0.1),
+		WithWindowSize(50),
+		WithPercentiles(1000),
+	)
+
+	// Prime with data
+	for i := 0; i < 100; i++ {
+		tracker.Process(100 * time.Millisecond)
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = tracker.Value()
+		}
+	})
+}
+
+// BenchmarkTracker_ConcurrentValueWhileProcessing benchmarks request
+// goroutines reading the stats of one hot key while a dispatcher records
+// samples for it
+func BenchmarkTracker_ConcurrentValueWhileProcessing(b *testing.B) {
+	tracker := NewTracker(
+		WithAlpha(0.1),
+		WithWindowSize(50),
+		WithPercentiles(1000),
+	)
+
+	// Prime with data
+	for i := 0; i < 100; i++ {
+		tracker.Process(100 * time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				tracker.Process(100 * time.Millisecond)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = tracker.Value()
+		}
+	})
+
+	b.StopTimer()
+	close(done)
+	<-stopped
+}
+
 // BenchmarkTracker_LevelWithThresholds benchmarks level calculation
 func BenchmarkTracker_LevelWithThresholds(b *testing.B) {
 	stats := Stats{
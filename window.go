@@ -0,0 +1,230 @@
+package floodgate
+
+import (
+	"cmp"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// timeWindowBuckets is the number of buckets a tracker time window is split
+// into. Samples leave the window one bucket at a time.
+const timeWindowBuckets = 10
+
+// defaultRateWindow is the window requests per second are measured over when
+// a tracker has no time window. The rate covers between one and two of them.
+const defaultRateWindow = 10 * time.Second
+
+// windowBucket summarizes the samples of one time bucket. Time-windowed
+// trackers take their request rate, trend, count, min, max and standard
+// deviation from them.
+type windowBucket struct {
+	epoch      int64
+	count      int64
+	sum        int64
+	sumSquares float64
+	min        int64
+	max        int64
+}
+
+// windowSummary describes the samples in the buckets still in a window.
+type windowSummary struct {
+	count  int64
+	min    int64
+	max    int64
+	stdDev float64
+	rps    float64
+}
+
+// timeEpoch returns the bucket number of now for buckets of width nanoseconds.
+func timeEpoch(now, width int64) int64 {
+	return now / width
+}
+
+// addToWindow adds value to the bucket for epoch, resetting it if it has
+// expired. Callers must hold mu.
+func (t *emaTracker) addToWindow(epoch, value int64) {
+	b := &t.windowBuckets[epoch%timeWindowBuckets]
+	if b.epoch != epoch {
+		*b = windowBucket{epoch: epoch, min: value, max: value}
+	}
+	b.count++
+	b.sum += value
+	b.sumSquares += float64(value) * float64(value)
+	b.min = min(b.min, value)
+	b.max = max(b.max, value)
+}
+
+// summarizeWindow summarizes the buckets still in the window at now. The rate
+// is over the whole window, or since the first sample if that is more recent.
+// Callers must hold mu.
+func (t *emaTracker) summarizeWindow(now int64) windowSummary {
+	epoch := timeEpoch(now, t.bucketWidth)
+
+	var summary windowSummary
+	var sum int64
+	var sumSquares float64
+	for e := epoch - timeWindowBuckets + 1; e <= epoch; e++ {
+		b := &t.windowBuckets[e%timeWindowBuckets]
+		if b.epoch != e || b.count == 0 {
+			continue
+		}
+		if summary.count == 0 || b.min < summary.min {
+			summary.min = b.min
+		}
+		summary.max = max(summary.max, b.max)
+		summary.count += b.count
+		sum += b.sum
+		sumSquares += b.sumSquares
+	}
+	if summary.count == 0 {
+		return summary
+	}
+
+	mean := float64(sum) / float64(summary.count)
+	summary.stdDev = math.Sqrt(max(sumSquares/float64(summary.count)-mean*mean, 0))
+
+	span := now - (epoch-timeWindowBuckets+1)*t.bucketWidth
+	if t.firstSampleAt > 0 {
+		span = min(span, now-t.firstSampleAt)
+	}
+	span = max(span, t.bucketWidth)
+	summary.rps = float64(summary.count) / time.Duration(span).Seconds()
+
+	return summary
+}
+
+// windowTrend returns the trend of the mean latency of each bucket still in
+// the window at epoch, oldest first. Slope is the change between consecutive
+// buckets. Callers must hold mu.
+func (t *emaTracker) windowTrend(epoch int64) (slope, drift int64, percentDrift float64) {
+	var means [timeWindowBuckets]int64
+	n := 0
+	for e := epoch - timeWindowBuckets + 1; e <= epoch; e++ {
+		b := &t.windowBuckets[e%timeWindowBuckets]
+		if b.epoch == e && b.count > 0 {
+			means[n] = b.sum / b.count
+			n++
+		}
+	}
+	return trend(means[:n])
+}
+
+// timeRing is the exact estimator for time-windowed trackers. It keeps up to
+// size samples spread over the buckets still in the window, and sorts a copy
+// of them when a quantile is read. Once a bucket is full, new samples replace
+// random ones, so a busy bucket stays a uniform sample of its traffic. Each
+// sample is weighted by the number of samples of its bucket it stands for, so
+// quantiles follow the traffic and a quiet bucket cannot dominate them.
+type timeRing struct {
+	width   int64
+	buckets [timeWindowBuckets]timeRingBucket
+	sorted  []weightedSample
+	total   float64
+
+	sortedEpoch int64
+	dirty       bool
+}
+
+type weightedSample struct {
+	value  int64
+	weight float64
+}
+
+type timeRingBucket struct {
+	epoch   int64
+	samples []int64
+	seen    int
+}
+
+func newTimeRing(size int, window time.Duration) *timeRing {
+	perBucket := max(size/timeWindowBuckets, 1)
+	r := &timeRing{
+		width:  max(int64(window/timeWindowBuckets), 1),
+		sorted: make([]weightedSample, 0, perBucket*timeWindowBuckets),
+	}
+	for i := range r.buckets {
+		r.buckets[i].samples = make([]int64, 0, perBucket)
+	}
+	return r
+}
+
+func (r *timeRing) Add(value time.Duration) {
+	epoch := timeEpoch(nanotime(), r.width)
+	b := &r.buckets[epoch%timeWindowBuckets]
+	if b.epoch != epoch {
+		b.epoch = epoch
+		b.samples = b.samples[:0]
+		b.seen = 0
+	}
+
+	b.seen++
+	switch {
+	case len(b.samples) < cap(b.samples):
+		b.samples = append(b.samples, int64(value))
+	default:
+		// Reservoir sampling keeps every sample equally likely to stay
+		if i := rand.IntN(b.seen); i < len(b.samples) {
+			b.samples[i] = int64(value)
+		}
+	}
+	r.dirty = true
+}
+
+func (r *timeRing) Quantile(q float64) time.Duration {
+	epoch := timeEpoch(nanotime(), r.width)
+	if r.dirty || r.sortedEpoch != epoch {
+		r.sorted = r.sorted[:0]
+		r.total = 0
+		for i := range r.buckets {
+			b := &r.buckets[i]
+			if epoch-b.epoch >= timeWindowBuckets || len(b.samples) == 0 {
+				continue
+			}
+			weight := float64(b.seen) / float64(len(b.samples))
+			for _, v := range b.samples {
+				r.sorted = append(r.sorted, weightedSample{value: v, weight: weight})
+			}
+			r.total += float64(b.seen)
+		}
+		slices.SortFunc(r.sorted, func(a, b weightedSample) int {
+			return cmp.Compare(a.value, b.value)
+		})
+		r.sortedEpoch = epoch
+		r.dirty = false
+	}
+
+	if len(r.sorted) == 0 {
+		return 0
+	}
+	target := q*r.total + 1e-9
+	var cumulative float64
+	for _, s := range r.sorted {
+		cumulative += s.weight
+		if cumulative > target {
+			return time.Duration(s.value)
+		}
+	}
+	return time.Duration(r.sorted[len(r.sorted)-1].value)
+}
+
+func (r *timeRing) Count() int {
+	epoch := timeEpoch(nanotime(), r.width)
+	n := 0
+	for i := range r.buckets {
+		if b := &r.buckets[i]; epoch-b.epoch < timeWindowBuckets {
+			n += len(b.samples)
+		}
+	}
+	return n
+}
+
+func (r *timeRing) Scale(factor float64) {
+	for i := range r.buckets {
+		for j, v := range r.buckets[i].samples {
+			r.buckets[i].samples[j] = int64(float64(v) * factor)
+		}
+	}
+	r.dirty = true
+}
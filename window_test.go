@@ -0,0 +1,116 @@
+package floodgate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracker_TimeWindowExpiresSamples(t *testing.T) {
+	tracker := NewTracker(
+		WithPercentiles(100),
+		WithTimeWindow(100*time.Millisecond),
+	)
+
+	for range 50 {
+		tracker.Process(500 * time.Millisecond)
+	}
+	if stats := tracker.Value(); stats.P95 != 500*time.Millisecond {
+		t.Fatalf("Expected P95 of 500ms, got %v", stats.P95)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+
+	if stats := tracker.Value(); stats.P95 != 0 {
+		t.Errorf("Expected expired samples to be dropped, got P95 %v", stats.P95)
+	}
+
+	for range 20 {
+		tracker.Process(10 * time.Millisecond)
+	}
+	if stats := tracker.Value(); stats.P99 != 10*time.Millisecond {
+		t.Errorf("Expected P99 of the new samples only, got %v", stats.P99)
+	}
+}
+
+func TestTracker_TimeWindowBoundsBusyBuckets(t *testing.T) {
+	tracker := NewTracker(
+		WithPercentiles(1000),
+		WithTimeWindow(time.Minute),
+	).(*emaTracker)
+
+	for i := range 10_000 {
+		tracker.Process(time.Duration(i%100+1) * time.Millisecond)
+	}
+
+	if n := tracker.quantiles.Count(); n > 1000 {
+		t.Errorf("Expected at most 1000 samples kept, got %d", n)
+	}
+	if stats := tracker.Value(); stats.P50 < 30*time.Millisecond || stats.P50 > 70*time.Millisecond {
+		t.Errorf("Expected P50 near 50ms from a uniform sample, got %v", stats.P50)
+	}
+}
+
+func TestTracker_TimeWindowTrend(t *testing.T) {
+	tracker := NewTracker(WithTimeWindow(time.Second)).(*emaTracker)
+
+	const base = 1000
+	for e := range int64(timeWindowBuckets) {
+		tracker.addToWindow(base+e, (e+1)*int64(time.Millisecond))
+		tracker.addToWindow(base+e, (e+1)*int64(time.Millisecond))
+	}
+
+	slope, drift, _ := tracker.windowTrend(base + timeWindowBuckets - 1)
+	if slope != int64(time.Millisecond) {
+		t.Errorf("Expected slope of 1ms per bucket, got %v", time.Duration(slope))
+	}
+	if drift != int64(5*time.Millisecond) {
+		t.Errorf("Expected drift of 5ms, got %v", time.Duration(drift))
+	}
+
+	// Once every bucket has left the window there is no trend
+	if slope, drift, _ := tracker.windowTrend(base + 2*timeWindowBuckets); slope != 0 || drift != 0 {
+		t.Errorf("Expected no trend after expiry, got slope %v drift %v", slope, drift)
+	}
+}
+
+func TestTracker_TimeWindowProcessAllocatesOnlySnapshot(t *testing.T) {
+	tracker := NewTracker(
+		WithPercentiles(1000),
+		WithTimeWindow(10*time.Millisecond),
+	)
+
+	// The window buckets are reused, only the published snapshot is new
+	allocs := testing.AllocsPerRun(10_000, func() {
+		tracker.Process(time.Millisecond)
+	})
+	if allocs > 1 {
+		t.Errorf("Expected Process to allocate only its snapshot, got %v allocs", allocs)
+	}
+	if stats := tracker.Value(); stats.Count == 0 {
+		t.Error("Expected Value to see the new samples")
+	}
+}
+
+func TestTimeRing_WeightsBucketsByTraffic(t *testing.T) {
+	r := newTimeRing(100, time.Hour)
+	epoch := timeEpoch(nanotime(), r.width)
+
+	// A busy bucket of fast requests and a quiet one of slow requests keep
+	// the same number of samples
+	busy := &r.buckets[epoch%timeWindowBuckets]
+	quiet := &r.buckets[(epoch-1)%timeWindowBuckets]
+	busy.epoch, quiet.epoch = epoch, epoch-1
+	for range 10 {
+		busy.samples = append(busy.samples, int64(time.Millisecond))
+		quiet.samples = append(quiet.samples, int64(100*time.Millisecond))
+	}
+	busy.seen, quiet.seen = 1000, 10
+	r.dirty = true
+
+	if p95 := r.Quantile(0.95); p95 != time.Millisecond {
+		t.Errorf("Expected P95 of the busy bucket's traffic, got %v", p95)
+	}
+	if highest := r.Quantile(1); highest != 100*time.Millisecond {
+		t.Errorf("Expected the quiet bucket's samples to still count, got %v", highest)
+	}
+}